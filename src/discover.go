@@ -0,0 +1,277 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/merridan/sngo/internal/logging"
+)
+
+// ignoreFileName is read in every directory searched for notes. It lists
+// files and folders to skip, one pattern per line, like a .gitignore.
+const ignoreFileName = ".snignore"
+
+// noteFilter decides which files note discovery picks up. Patterns are
+// matched against slash-separated paths relative to the directory being
+// searched; a pattern without a slash matches the file or folder name at any
+// depth, and ** matches any number of folders.
+type noteFilter struct {
+	include []string // if set, only notes matching one of these are taken
+	exclude []string // notes and folders matching any of these are skipped
+	hidden  bool     // also search folders whose name starts with a dot
+}
+
+// findNoteFiles finds all .note files under dir, in lexical order. Folders
+// are searched recursively, following symbolic links. Every folder is
+// searched once, under one path: a link to a folder inside dir is skipped, as
+// the folder is found at its real path, and of several links to one folder
+// outside dir the first in lexical order is used. Everything skipped is
+// logged at debug level.
+func findNoteFiles(dir string, filter *noteFilter) ([]string, error) {
+	w, err := searchNotes(dir, filter)
+	if err != nil {
+		return nil, err
+	}
+	return w.files, nil
+}
+
+// findNoteDirs returns the folders findNoteFiles searches, for watching them.
+func findNoteDirs(dir string, filter *noteFilter) ([]string, error) {
+	w, err := searchNotes(dir, filter)
+	if err != nil {
+		return nil, err
+	}
+	return w.dirs, nil
+}
+
+func searchNotes(dir string, filter *noteFilter) (*noteWalker, error) {
+	if filter == nil {
+		filter = &noteFilter{}
+	}
+	w := &noteWalker{filter: filter, visited: map[string]bool{}}
+	if err := w.walk(dir, "", nil); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+type noteWalker struct {
+	filter  *noteFilter
+	root    string          // the search root, with links resolved
+	visited map[string]bool // folders searched so far, with links resolved
+	files   []string
+	dirs    []string
+}
+
+func (w *noteWalker) walk(dir, rel string, rules []ignoreRule) error {
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if rel == "" {
+		w.root = real
+	}
+	if w.visited[real] {
+		logging.Debug("skipping %s: already searched as %s (symlink loop or second link)", dir, real)
+		return nil
+	}
+	w.visited[real] = true
+	w.dirs = append(w.dirs, dir)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, ignoreFileName)); err == nil {
+		// Copy so sibling folders do not see each other's rules
+		rules = append(rules[:len(rules):len(rules)], parseIgnoreFile(string(data), rel)...)
+	}
+	for _, e := range entries {
+		p := filepath.Join(dir, e.Name())
+		childRel := path.Join(rel, e.Name())
+		isDir := e.IsDir()
+		if e.Type()&fs.ModeSymlink != 0 {
+			info, err := os.Stat(p)
+			if err != nil {
+				logging.Debug("skipping %s: broken symlink", p)
+				continue
+			}
+			isDir = info.IsDir()
+		}
+		if !isDir && !isNoteFile(e.Name()) {
+			continue
+		}
+		if isDir && e.Type()&fs.ModeSymlink != 0 {
+			if real, ok := w.insideRoot(p); ok {
+				logging.Debug("skipping %s: links to %s, which is searched at its own path", p, real)
+				continue
+			}
+		}
+		if reason := w.skipReason(childRel, isDir, rules); reason != "" {
+			logging.Debug("skipping %s: %s", p, reason)
+			continue
+		}
+		if !isDir {
+			w.files = append(w.files, p)
+			continue
+		}
+		// An unreadable folder costs its notes, not the whole run
+		if err := w.walk(p, childRel, rules); err != nil {
+			logging.Warn("skipping %s: %v", p, err)
+		}
+	}
+	return nil
+}
+
+// insideRoot resolves the link p and reports whether it leads into the
+// search root, returning the folder it leads to relative to the root.
+func (w *noteWalker) insideRoot(p string) (string, bool) {
+	real, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(w.root, real)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// skipReason says why a file or folder is left out, or returns "" to take it
+func (w *noteWalker) skipReason(rel string, isDir bool, rules []ignoreRule) string {
+	name := path.Base(rel)
+	if isDir && strings.HasPrefix(name, ".") && !w.filter.hidden {
+		return "hidden folder"
+	}
+	if r := matchIgnoreRules(rules, rel, isDir); r != nil {
+		return "ignored by " + path.Join(r.base, ignoreFileName) + " pattern " + r.text
+	}
+	for _, pattern := range w.filter.exclude {
+		if matchFilterPattern(pattern, rel) {
+			return "excluded by " + pattern
+		}
+	}
+	if !isDir && len(w.filter.include) > 0 {
+		for _, pattern := range w.filter.include {
+			if matchFilterPattern(pattern, rel) {
+				return ""
+			}
+		}
+		return "not matched by -include"
+	}
+	return ""
+}
+
+func isNoteFile(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), ".note")
+}
+
+// matchFilterPattern matches an -include or -exclude pattern: against the
+// name if it has no slash, else against the whole relative path.
+func matchFilterPattern(pattern, rel string) bool {
+	pattern = filepath.ToSlash(pattern)
+	if !strings.Contains(pattern, "/") {
+		return matchGlob(pattern, path.Base(rel))
+	}
+	return matchGlob(strings.TrimPrefix(pattern, "/"), rel)
+}
+
+// matchGlob reports whether the slash path name matches pattern. *, ? and
+// [...] work as in path.Match within one path element; ** matches any
+// number of elements, including none.
+func matchGlob(pattern, name string) bool {
+	return matchElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchElems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// ignoreRule is one pattern of a .snignore file
+type ignoreRule struct {
+	base     string // folder of the .snignore, relative to the search root
+	text     string // the line as written, for log messages
+	pattern  string
+	negate   bool // "!pattern" takes back an earlier match
+	dirOnly  bool // "pattern/" only matches folders
+	anchored bool // a pattern with a slash is relative to base, not matched by name
+}
+
+// parseIgnoreFile reads .snignore lines with gitignore semantics: blank lines
+// and lines starting with # are skipped, and a leading \ escapes # or !.
+func parseIgnoreFile(data, base string) []ignoreRule {
+	var rules []ignoreRule
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r := ignoreRule{base: base, text: line}
+		if strings.HasPrefix(line, "!") {
+			r.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		r.anchored = strings.Contains(line, "/")
+		r.pattern = strings.TrimPrefix(line, "/")
+		if r.pattern != "" {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+func (r *ignoreRule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.base != "" {
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+		rel = rel[len(r.base)+1:]
+	}
+	if r.anchored {
+		return matchGlob(r.pattern, rel)
+	}
+	return matchGlob(r.pattern, path.Base(rel))
+}
+
+// matchIgnoreRules returns the rule that ignores rel, or nil. As in git the
+// last matching rule wins, and rules of deeper folders come last.
+func matchIgnoreRules(rules []ignoreRule, rel string, isDir bool) *ignoreRule {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].match(rel, isDir) {
+			if rules[i].negate {
+				return nil
+			}
+			return &rules[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindNoteFilesFilters(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{
+		"a.note",
+		"b.NOTE",
+		"notes.txt",
+		"conflicted copy.note",
+		".Trash/old.note",
+		"EXPORT/a.note",
+		"Work/x.note",
+		"Work/draft.note",
+		"Work/keep/draft.note",
+		"Work/Deep/y.note",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ignores := map[string]string{
+		".snignore":      "# device folders\nEXPORT/\n*conflicted*\n",
+		"Work/.snignore": "draft.note\n!keep/draft.note\n/Deep\n",
+	}
+	for f, text := range ignores {
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(f)), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A loop back to the root and links to Work, one sorting before it, are
+	// searched once, at Work's own path
+	if err := os.Symlink(dir, filepath.Join(dir, "Work", "loop")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	for _, link := range []string{"A-link", "z-link"} {
+		if err := os.Symlink(filepath.Join(dir, "Work"), filepath.Join(dir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter *noteFilter
+		want   []string
+	}{
+		{"default", nil, []string{"Work/keep/draft.note", "Work/x.note", "a.note", "b.NOTE"}},
+		{"hidden", &noteFilter{hidden: true}, []string{".Trash/old.note", "Work/keep/draft.note", "Work/x.note", "a.note", "b.NOTE"}},
+		{"exclude name", &noteFilter{exclude: []string{"keep", "b.*"}}, []string{"Work/x.note", "a.note"}},
+		{"include path", &noteFilter{include: []string{"Work/**"}}, []string{"Work/keep/draft.note", "Work/x.note"}},
+		{"include name", &noteFilter{include: []string{"?.note"}, exclude: []string{"/Work/x.note"}}, []string{"a.note"}},
+	}
+	for _, tt := range tests {
+		files, err := findNoteFiles(dir, tt.filter)
+		if err != nil {
+			t.Fatalf("%s: findNoteFiles failed: %v", tt.name, err)
+		}
+		var got []string
+		for _, f := range files {
+			rel, _ := filepath.Rel(dir, f)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFindNoteFilesLinksOutsideRoot(t *testing.T) {
+	dir, outside := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "x.note"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Two links to one folder outside the root: the first in lexical order wins
+	for _, link := range []string{"b-link", "a-link"} {
+		if err := os.Symlink(outside, filepath.Join(dir, link)); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+	files, err := findNoteFiles(dir, nil)
+	if err != nil {
+		t.Fatalf("findNoteFiles failed: %v", err)
+	}
+	if want := []string{filepath.Join(dir, "a-link", "x.note")}; !reflect.DeepEqual(files, want) {
+		t.Errorf("got %q, want %q", files, want)
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.note", "a.note", true},
+		{"*.note", "Work/a.note", false},
+		{"**/a.note", "a.note", true},
+		{"**/a.note", "Work/Deep/a.note", true},
+		{"Work/**", "Work/Deep/a.note", true},
+		{"Work/**/a.note", "Work/a.note", true},
+		{"Work/*/a.note", "Work/a.note", false},
+		{"W?rk/[a-c].note", "Work/b.note", true},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/merridan/sngo/internal/converter"
+	"github.com/merridan/sngo/internal/logging"
+	"github.com/merridan/sngo/internal/note"
+)
+
+// writeNotebookEPUB packages the selected pages of nb as a fixed-layout EPUB. Pages
+// are rendered and PNG-encoded in parallel on the page pool, then stored in
+// order.
+func writeNotebookEPUB(nb *note.Notebook, pageNums []int, outPath string, modTime time.Time, opts *convertOptions) error {
+	scale := opts.scaleFor(nb)
+
+	pages := make([][]byte, len(pageNums))
+	pageErrs := make([]error, len(pageNums))
+	sizes := make([]image.Point, len(pageNums))
+	var wg sync.WaitGroup
+	for i, pageNum := range pageNums {
+		wg.Add(1)
+		go func(i, pageNum int) {
+			defer wg.Done()
+			opts.pool.Do(func() {
+				img, err := converter.ConvertPageToImageAt(nb, pageNum, scale)
+				if err != nil {
+					pageErrs[i] = err
+					return
+				}
+				sizes[i] = img.Bounds().Size()
+				var buf bytes.Buffer
+				pageErrs[i] = opts.png.Encode(&buf, img)
+				pages[i] = buf.Bytes()
+				releaseImage(img)
+			})
+		}(i, pageNum)
+	}
+	wg.Wait()
+	for i, err := range pageErrs {
+		if err != nil {
+			return fmt.Errorf("page %d: %w", pageNums[i], err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %v", filepath.Dir(outPath), err)
+	}
+	file, err := createOutput(outPath)
+	if err != nil {
+		return err
+	}
+	err = converter.WriteEPUB(file, nb, converter.EPUBOptions{
+		Title:    strings.TrimSuffix(filepath.Base(outPath), ".epub"),
+		Modified: modTime,
+		Sizes:    sizes,
+		Pages:    pageNums,
+	}, pages)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("write %s: %w", outPath, err)
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	setModTime(outPath, modTime)
+	logging.Info("wrote %s (%d pages)", outPath, len(pages))
+	return nil
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/merridan/sngo/internal/logging"
+	"github.com/merridan/sngo/internal/note"
+	"github.com/merridan/sngo/internal/state"
+)
+
+// runStats counts what a run did, for the summary at the end. Page counts
+// cover the notes that were converted.
+type runStats struct {
+	converted, unchanged, failed atomic.Int64
+	pagesReused, pagesRendered   atomic.Int64
+}
+
+// addPages counts pages kept from the previous run and pages rendered; a nil
+// *runStats counts nothing.
+func (s *runStats) addPages(reused, rendered int) {
+	if s == nil {
+		return
+	}
+	s.pagesReused.Add(int64(reused))
+	s.pagesRendered.Add(int64(rendered))
+}
+
+func (s *runStats) summary() string {
+	return fmt.Sprintf("%d note(s) converted, %d unchanged, %d failed; %d pages reused, %d re-rendered",
+		s.converted.Load(), s.unchanged.Load(), s.failed.Load(), s.pagesReused.Load(), s.pagesRendered.Load())
+}
+
+// settings describes the options a note's outputs depend on. Outputs made
+// with other settings are never reused.
+func (o *convertOptions) settings(inputPath string, out noteOutput) string {
+	spec := o.pages
+	if s, ok := o.notePages[inputPath]; ok {
+		spec = s
+	}
+	pages := "all"
+	if spec != nil {
+		pages = spec.String()
+	}
+	return fmt.Sprintf("format=%s layout=%s scale=%g dpi=%d ink-only=%t png=%+v replay=%+v sheet=%+v names=%s pages=%q out=%s",
+		o.format, o.layout, o.scale, o.dpi, o.inkOnly, o.png.Options(), o.replay, o.sheet, o.pageNames(), pages, filepath.ToSlash(out.rel))
+}
+
+// noteRecord follows one note through a run with a state file: what the
+// previous run recorded, and the record this run builds. A nil *noteRecord
+// (no state file, standard input or -stdout) records nothing and reuses nothing.
+type noteRecord struct {
+	key    string // note file as recorded in the state file
+	outDir string
+	state  *state.State
+	prev   *state.Note // nil if the note is new, changed settings or -force
+
+	mu     sync.Mutex
+	next   *state.Note
+	failed bool
+}
+
+// checkNote decides whether a note needs converting. It returns nil and
+// false when there is no state to keep, and true when the note and its
+// outputs are as the previous run left them.
+func checkNote(inputPath string, out noteOutput, opts *convertOptions) (*noteRecord, bool, error) {
+	if opts.state == nil || inputPath == stdinPath || opts.stdout {
+		return nil, false, nil
+	}
+	key, err := filepath.Abs(inputPath)
+	if err != nil {
+		return nil, false, err
+	}
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		return nil, false, err
+	}
+	rec := &noteRecord{key: key, outDir: out.root, state: opts.state}
+	rec.next = &state.Note{
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+		Settings: opts.settings(inputPath, out),
+		Output:   filepath.ToSlash(out.rel),
+	}
+	if prev := opts.state.Note(key); prev != nil {
+		rec.next.Renames = prev.Renames
+		if !opts.force && prev.Settings == rec.next.Settings {
+			rec.prev = prev
+		}
+	}
+
+	// Size and time are enough to trust an unchanged note; a sync client
+	// touching the file costs a hash, not a conversion.
+	if rec.prev != nil && rec.prev.Hash != "" && rec.prev.Size == info.Size() && rec.prev.ModTime.Equal(info.ModTime()) && rec.outputsExist() {
+		return rec, true, nil
+	}
+	if rec.next.Hash, err = hashFile(inputPath); err != nil {
+		return nil, false, err
+	}
+	if rec.prev != nil && rec.prev.Hash == rec.next.Hash && rec.outputsExist() {
+		updated := *rec.prev
+		updated.Size, updated.ModTime = rec.next.Size, rec.next.ModTime
+		opts.state.SetNote(key, &updated)
+		return rec, true, nil
+	}
+	return rec, false, nil
+}
+
+// outputsExist reports whether every output of the previous run is still there
+func (r *noteRecord) outputsExist() bool {
+	for _, f := range r.prev.Files {
+		if _, err := os.Stat(filepath.Join(r.outDir, filepath.FromSlash(f))); err != nil {
+			logging.Debug("%s: output %s is missing", r.key, f)
+			return false
+		}
+	}
+	return true
+}
+
+// start fills in what parsing the note tells
+func (r *noteRecord) start(nb *note.Notebook) {
+	if r == nil {
+		return
+	}
+	r.next.FileID = string(nb.FileID)
+	r.next.Pages = make([]state.Page, len(nb.Pages))
+	for i, page := range nb.Pages {
+		r.next.Pages[i].ID = string(page.ID())
+	}
+}
+
+// reusePages returns the selected pages that need rendering; the others keep
+// their file from the previous run, which is recorded again.
+func reusePages(nb *note.Notebook, pages []int, files []string, rec *noteRecord, stats *runStats) []int {
+	var render []int
+	for _, pageNum := range pages {
+		if rec.reusable(pageNum, files[pageNum], nb.Pages[pageNum].Hash) {
+			rec.page(pageNum, files[pageNum], nb.Pages[pageNum].Hash)
+			logging.Debug("kept %s, page unchanged", files[pageNum])
+			continue
+		}
+		render = append(render, pageNum)
+	}
+	stats.addPages(len(pages)-len(render), 0)
+	return render
+}
+
+// reusable reports whether a page's file from the previous run was made from
+// content with the same hash, under the same name, and still exists.
+func (r *noteRecord) reusable(pageNum int, file, hash string) bool {
+	if r == nil || r.prev == nil || hash == "" || pageNum >= len(r.prev.Pages) {
+		return false
+	}
+	p := r.prev.Pages[pageNum]
+	if p.Hash != hash || p.File != r.rel(file) {
+		return false
+	}
+	_, err := os.Stat(file)
+	return err == nil
+}
+
+// page records a page file written or reused, with the content hash of the page.
+func (r *noteRecord) page(pageNum int, file, hash string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.next.Pages[pageNum].Hash = hash
+	r.next.Pages[pageNum].File = r.rel(file)
+	r.next.Files = append(r.next.Files, r.rel(file))
+	r.state.Track(r.rel(file))
+}
+
+// file records an output that is not a page file (.tiff, .epub, .md, sheets)
+func (r *noteRecord) file(path string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.next.Files = append(r.next.Files, r.rel(path))
+	r.state.Track(r.rel(path))
+}
+
+// fail marks the note as not fully converted, so the next run tries again
+func (r *noteRecord) fail() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failed = true
+}
+
+// save stores the record once the note is done
+func (r *noteRecord) save(st *state.State) {
+	if r == nil {
+		return
+	}
+	if r.failed {
+		r.next.Hash = ""
+	}
+	st.SetNote(r.key, r.next)
+}
+
+// saveFailed stores what a failed note did write, so the next run converts it
+// again but reuses the pages that were written
+func (r *noteRecord) saveFailed(st *state.State) {
+	if r == nil || len(r.next.Files) == 0 {
+		return
+	}
+	r.fail()
+	r.save(st)
+}
+
+func (r *noteRecord) rel(path string) string {
+	rel, err := filepath.Rel(r.outDir, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// hashFile returns the hex SHA-256 of a file's content
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// loadState reads the state file of outDir; an unreadable one is reported and
+// replaced, which costs one full rebuild.
+func loadState(outDir string) *state.State {
+	st, err := state.Load(outDir)
+	if err != nil {
+		logging.Warn("ignoring state file: %v", err)
+	}
+	return st
+}
+
+// saveState writes the state file at the end of a run
+func saveState(st *state.State) {
+	if err := st.Save(); err != nil {
+		logging.Error("failed to save %s: %v", st.Path(), err)
+		return
+	}
+	logging.Debug("saved %s", st.Path())
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/merridan/sngo/internal/converter"
+	"github.com/merridan/sngo/internal/state"
+)
+
+func TestProcessNoteFileIncremental(t *testing.T) {
+	notePath := "../example_notes/example.note"
+	outDir := t.TempDir()
+	out := noteOutput{root: outDir, rel: "example"}
+	newOpts := func(force bool) *convertOptions {
+		st, err := state.Load(outDir)
+		if err != nil {
+			t.Fatalf("state.Load failed: %v", err)
+		}
+		return &convertOptions{
+			pool:  newPagePool(2),
+			png:   converter.NewPNGEncoder(converter.PNGOptions{Compression: png.BestSpeed}),
+			state: st,
+			force: force,
+			stats: &runStats{},
+		}
+	}
+	run := func(opts *convertOptions) {
+		t.Helper()
+		if err := processNoteFile(notePath, out, opts); err != nil {
+			t.Fatalf("processNoteFile failed: %v", err)
+		}
+		if err := opts.state.Save(); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+
+	opts := newOpts(false)
+	run(opts)
+	if opts.stats.converted.Load() != 1 {
+		t.Fatalf("Expected the first run to convert the note: %s", opts.stats.summary())
+	}
+
+	// A marker in the page file shows whether a later run rewrote it
+	pageFile := filepath.Join(outDir, "example", "page_000.png")
+	if err := os.WriteFile(pageFile, []byte("kept"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts = newOpts(false)
+	run(opts)
+	if opts.stats.unchanged.Load() != 1 {
+		t.Errorf("Expected an unchanged note to be skipped: %s", opts.stats.summary())
+	}
+
+	// A note whose content hash changed is converted again, but pages whose
+	// layers are unchanged are not rendered
+	key, _ := filepath.Abs(notePath)
+	rec := *opts.state.Note(key)
+	rec.Hash, rec.Size = "stale", 0
+	opts.state.SetNote(key, &rec)
+	opts.state.Save()
+	opts = newOpts(false)
+	run(opts)
+	if opts.stats.converted.Load() != 1 {
+		t.Errorf("Expected a changed note to be converted: %s", opts.stats.summary())
+	}
+	if data, _ := os.ReadFile(pageFile); string(data) != "kept" {
+		t.Error("Expected the unchanged page not to be re-rendered")
+	}
+	if opts.stats.pagesReused.Load() != 1 || opts.stats.pagesRendered.Load() != 0 {
+		t.Errorf("Expected one page reused: %s", opts.stats.summary())
+	}
+
+	opts = newOpts(true)
+	run(opts)
+	if data, _ := os.ReadFile(pageFile); string(data) == "kept" {
+		t.Error("Expected -force to rewrite the page")
+	}
+}
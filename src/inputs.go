@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/merridan/sngo/internal/note"
+)
+
+// stdinPath stands for standard input in place of a note file
+const stdinPath = "-"
+
+// noteInput is a note to convert and the folder its output path mirrors from
+type noteInput struct {
+	path string // note file, or stdinPath
+	root string // input directory the note was found in; "" for files named directly
+}
+
+// collectInputs expands command line paths into notes: directories are
+// searched recursively for .note files, files are taken as they are (whatever
+// their extension), and "-" reads one note from standard input. A note named
+// twice is converted once. filter only applies to the directory search.
+func collectInputs(paths []string, filter *noteFilter) ([]noteInput, error) {
+	var inputs []noteInput
+	seen := map[string]bool{}
+	add := func(in noteInput) {
+		key := in.path
+		if abs, err := filepath.Abs(in.path); err == nil && in.path != stdinPath {
+			key = abs
+		}
+		if !seen[key] {
+			seen[key] = true
+			inputs = append(inputs, in)
+		}
+	}
+	for _, p := range paths {
+		if p == stdinPath {
+			add(noteInput{path: stdinPath})
+			continue
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			add(noteInput{path: p})
+			continue
+		}
+		noteFiles, err := findNoteFiles(p, filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find .note files in %s: %v", p, err)
+		}
+		for _, f := range noteFiles {
+			add(noteInput{path: f, root: p})
+		}
+	}
+	return inputs, nil
+}
+
+// openNote opens and parses a note. Standard input is read into memory first,
+// since note.Parse needs to seek; it is stamped with the current time. The
+// returned closer must stay open while pages are decoded.
+func openNote(inputPath string) (*note.Notebook, time.Time, io.Closer, error) {
+	if inputPath == stdinPath {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, time.Time{}, nil, fmt.Errorf("failed to read standard input: %v", err)
+		}
+		nb, err := note.Parse(bytes.NewReader(data))
+		if err != nil {
+			return nil, time.Time{}, nil, fmt.Errorf("failed to parse standard input: %v", err)
+		}
+		return nb, time.Now(), io.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	f, err := os.Open(inputPath)
+	if err != nil {
+		return nil, time.Time{}, nil, fmt.Errorf("failed to open %s: %v", inputPath, err)
+	}
+	nb, err := note.Parse(f)
+	if err != nil {
+		f.Close()
+		return nil, time.Time{}, nil, fmt.Errorf("failed to parse %s: %v", inputPath, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, time.Time{}, nil, fmt.Errorf("failed to stat %s: %v", inputPath, err)
+	}
+	return nb, info.ModTime(), f, nil
+}
@@ -9,7 +9,9 @@ import (
 
 // Config represents the configuration file structure
 type Config struct {
-	SupernotePath string `json:"supernote_path"`
+	SupernotePath string            `json:"supernote_path"`
+	NameTemplate  string            `json:"name_template"` // page file names, see -name-template
+	Pages         map[string]string `json:"pages"`         // per-note -pages, keyed by path under the input or file name
 }
 
 // Load loads configuration from config.json file
@@ -1,9 +1,198 @@
 package converter
 
 import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"os"
 	"testing"
+
+	"github.com/merridan/sngo/internal/note"
+	"github.com/merridan/sngo/internal/render"
 )
 
-func TestDummy(t *testing.T) {
-	// Add real tests when converter logic is implemented
+func openExample(tb testing.TB) *note.Notebook {
+	f, err := os.Open("../../../example_notes/example.note")
+	if err != nil {
+		tb.Fatalf("failed to open example.note: %v", err)
+	}
+	tb.Cleanup(func() { f.Close() })
+	nb, err := note.Parse(f)
+	if err != nil {
+		tb.Fatalf("Parse failed: %v", err)
+	}
+	return nb
+}
+
+func TestInkOnlyPNGIsTransparent(t *testing.T) {
+	nb := openExample(t)
+	ink, err := nb.DecodeMainLayer(0)
+	if err != nil {
+		t.Fatalf("DecodeMainLayer failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := NewPNGEncoder(PNGOptions{KeepAlpha: true}).Encode(&buf, ink); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	// IHDR color type lives at byte 25; 6 is truecolor with alpha
+	if ct := buf.Bytes()[25]; ct != 6 {
+		t.Errorf("Expected RGBA PNG (color type 6), got %d", ct)
+	}
+	decoded, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("png.Decode failed: %v", err)
+	}
+	if _, _, _, a := decoded.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("Expected untouched paper at (0,0) to be transparent, got alpha %d", a)
+	}
+}
+
+// BenchmarkConvertAndEncodePNG measures a full page: pooled decode, composite and fast-path encode.
+func BenchmarkConvertAndEncodePNG(b *testing.B) {
+	nb := openExample(b)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		img, err := ConvertPageToImage(nb, 0)
+		if err != nil {
+			b.Fatalf("ConvertPageToImage failed: %v", err)
+		}
+		if err := EncodePNG(io.Discard, img); err != nil {
+			b.Fatalf("EncodePNG failed: %v", err)
+		}
+		img.(*note.GrayImage).Release()
+	}
+}
+
+// BenchmarkConvertAndEncodePNGAt is the baseline: png.Encode walking the page through At.
+func BenchmarkConvertAndEncodePNGAt(b *testing.B) {
+	nb := openExample(b)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		img, err := ConvertPageToImage(nb, 0)
+		if err != nil {
+			b.Fatalf("ConvertPageToImage failed: %v", err)
+		}
+		if err := png.Encode(io.Discard, img); err != nil {
+			b.Fatalf("png.Encode failed: %v", err)
+		}
+	}
+}
+
+func TestDecodeLayersScaled(t *testing.T) {
+	nb := openExample(t)
+	main, bg, err := DecodeLayersScaled(nb, 0, 2, true)
+	if err != nil {
+		t.Fatalf("DecodeLayersScaled failed: %v", err)
+	}
+	defer main.Release()
+	if b := main.Bounds(); b.Dx() != 2*nb.W || b.Dy() != 2*nb.H {
+		t.Errorf("Expected %dx%d main layer, got %v", 2*nb.W, 2*nb.H, b)
+	}
+	if bg != nil {
+		if bg.Bounds() != main.Bounds() {
+			t.Errorf("Expected background bounds %v, got %v", main.Bounds(), bg.Bounds())
+		}
+		bg.Release()
+	}
+	if _, _, err := DecodeLayersScaled(nb, 0, 0, false); err == nil {
+		t.Errorf("Expected error for zero scale")
+	}
+}
+
+func TestDecodeLayersScaledLandscape(t *testing.T) {
+	nb := openExample(t)
+	nb.Pages[0].Params["ORIENTATION"] = "1090"
+	main, bg, err := DecodeLayersScaled(nb, 0, 0.5, true)
+	if err != nil {
+		t.Fatalf("DecodeLayersScaled failed: %v", err)
+	}
+	defer main.Release()
+	// Landscape pages decode as H*W and must keep that shape when scaled
+	if b := main.Bounds(); b.Dx() != nb.H/2 || b.Dy() != nb.W/2 {
+		t.Errorf("Expected %dx%d main layer, got %v", nb.H/2, nb.W/2, b)
+	}
+	if bg != nil {
+		if bg.Bounds() != main.Bounds() {
+			t.Errorf("Expected background bounds %v, got %v", main.Bounds(), bg.Bounds())
+		}
+		bg.Release()
+	}
+}
+
+func TestEraseStrokesKeepsOtherContent(t *testing.T) {
+	// A device bitmap with a stroke along y=10 and a pasted image block below it
+	bitmap := note.NewGrayImage(image.Rect(0, 0, 40, 40), true)
+	defer bitmap.Release()
+	pix, alpha := bitmap.Pix(), bitmap.Alpha()
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 40; x++ {
+			i := bitmap.PixOffset(x, y)
+			switch {
+			case y >= 8 && y <= 12 && x >= 5 && x <= 35:
+				pix[i] = 0
+			case y >= 25 && y < 35 && x >= 10 && x < 20:
+				pix[i] = 0x80
+			default:
+				alpha[i] = 0
+			}
+		}
+	}
+	strokes := []note.Stroke{{Width: 64, Points: []note.Point{{X: 6, Y: 10, Pressure: 1}, {X: 34, Y: 10, Pressure: 1}}}}
+	if n := eraseStrokes(bitmap, strokes); n != 100 {
+		t.Errorf("Expected the 100 pixels of the image block to remain, got %d", n)
+	}
+	if alpha[bitmap.PixOffset(20, 10)] != 0 {
+		t.Errorf("Expected stroke pixels to be erased")
+	}
+
+	// The remaining block ends up under the re-rendered strokes
+	layer := render.Layer(strokes, 80, 80, 2)
+	defer layer.Release()
+	rest := Resample(bitmap, 80, 80)
+	defer rest.Release()
+	overlay(layer, rest)
+	if i := layer.PixOffset(30, 60); layer.Alpha()[i] != 0xff || layer.Pix()[i] != 0x80 {
+		t.Errorf("Expected the image block in the scaled layer, got %d alpha %d", layer.Pix()[i], layer.Alpha()[i])
+	}
+	if i := layer.PixOffset(40, 20); layer.Alpha()[i] != 0xff || layer.Pix()[i] != 0 {
+		t.Errorf("Expected the stroke on top, got %d alpha %d", layer.Pix()[i], layer.Alpha()[i])
+	}
+	if i := layer.PixOffset(70, 5); layer.Alpha()[i] != 0 {
+		t.Errorf("Expected empty paper to stay transparent")
+	}
+}
+
+func TestResample(t *testing.T) {
+	src := note.NewGrayImage(image.Rect(0, 0, 4, 4), false)
+	defer src.Release()
+	for i := range src.Pix() {
+		src.Pix()[i] = 0x40
+	}
+	dst := Resample(src, 8, 8)
+	defer dst.Release()
+	if dst.Bounds().Dx() != 8 || dst.Bounds().Dy() != 8 {
+		t.Fatalf("Expected 8x8 image, got %v", dst.Bounds())
+	}
+	for i, v := range dst.Pix() {
+		if v != 0x40 {
+			t.Fatalf("Expected uniform 0x40 after resample, got %#x at %d", v, i)
+		}
+	}
+}
+
+func TestThumbnailKeepsThinLines(t *testing.T) {
+	src := note.NewGrayImage(image.Rect(0, 0, 60, 80), false)
+	defer src.Release()
+	for y := 0; y < 80; y++ {
+		src.Pix()[src.PixOffset(31, y)] = 0 // one-pixel vertical line
+	}
+	thumb := Thumbnail(src, 6)
+	defer thumb.Release()
+	if b := thumb.Bounds(); b.Dx() != 6 || b.Dy() != 8 {
+		t.Fatalf("Expected 6x8 thumbnail, got %v", b)
+	}
+	if v := thumb.Pix()[thumb.PixOffset(3, 4)]; v == 0xff {
+		t.Errorf("Expected the line to darken its thumbnail column")
+	}
 }
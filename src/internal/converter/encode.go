@@ -0,0 +1,124 @@
+package converter
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/merridan/sngo/internal/logging"
+	"github.com/merridan/sngo/internal/note"
+)
+
+// nrgbaPool recycles the 4*w*h backing arrays used when a page keeps its alpha.
+var nrgbaPool sync.Pool
+
+// encoderBuffers shares zlib writers and scanline buffers between all PNG
+// encoders, so concurrent workers stop allocating them for every page.
+var encoderBuffers = &encoderBufferPool{}
+
+type encoderBufferPool struct{ p sync.Pool }
+
+func (b *encoderBufferPool) Get() *png.EncoderBuffer {
+	eb, _ := b.p.Get().(*png.EncoderBuffer)
+	return eb
+}
+
+func (b *encoderBufferPool) Put(eb *png.EncoderBuffer) { b.p.Put(eb) }
+
+// PNGOptions configures a PNGEncoder.
+type PNGOptions struct {
+	Compression png.CompressionLevel
+	// Paletted writes pages that use at most 16 gray/alpha values as
+	// 1/2/4-bit paletted PNGs; other pages fall back to 8-bit output.
+	Paletted bool
+	// KeepAlpha writes pages that carry an alpha mask as RGBA even when every
+	// pixel happens to be opaque, so a batch has one consistent color type.
+	KeepAlpha bool
+}
+
+// PNGEncoder writes pages with fixed options. It is safe for concurrent use.
+type PNGEncoder struct {
+	enc  png.Encoder
+	opts PNGOptions
+}
+
+// NewPNGEncoder returns an encoder using opts and the shared buffer pool.
+func NewPNGEncoder(opts PNGOptions) *PNGEncoder {
+	return &PNGEncoder{enc: png.Encoder{CompressionLevel: opts.Compression, BufferPool: encoderBuffers}, opts: opts}
+}
+
+// Options returns the options the encoder was created with.
+func (e *PNGEncoder) Options() PNGOptions { return e.opts }
+
+var defaultPNGEncoder = NewPNGEncoder(PNGOptions{Compression: png.DefaultCompression})
+
+// ParseCompressionLevel maps a flag value (default, speed, best, none) to a png.CompressionLevel.
+func ParseCompressionLevel(s string) (png.CompressionLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "default":
+		return png.DefaultCompression, nil
+	case "speed", "fast":
+		return png.BestSpeed, nil
+	case "best", "size":
+		return png.BestCompression, nil
+	case "none":
+		return png.NoCompression, nil
+	default:
+		return 0, fmt.Errorf("unknown PNG compression %q (want default, speed, best or none)", s)
+	}
+}
+
+// EncodePNG writes img as PNG with default compression.
+func EncodePNG(w io.Writer, img image.Image) error {
+	return defaultPNGEncoder.Encode(w, img)
+}
+
+// Encode writes img as PNG. Decoded note pages are handed to the encoder as
+// *image.Gray (sharing the decoded pixels) or *image.NRGBA so png.Encode takes
+// its row-copy fast paths instead of calling At for every pixel.
+func (e *PNGEncoder) Encode(w io.Writer, img image.Image) error {
+	g, ok := img.(*note.GrayImage)
+	if !ok {
+		return e.enc.Encode(w, img)
+	}
+	if e.opts.Paletted {
+		b := g.Bounds()
+		buf := getPalettedBuf(b.Dx() * b.Dy())
+		defer palettedPool.Put(&buf)
+		if p, ok := ToPaletted(g, buf); ok {
+			return e.enc.Encode(w, p)
+		}
+		logging.Debug("page uses more than %d gray levels, writing 8-bit PNG", maxPaletteColors)
+	}
+	if g.Alpha() == nil || (!e.opts.KeepAlpha && g.Opaque()) {
+		return e.enc.Encode(w, g.ToGray())
+	}
+	b := g.Bounds()
+	buf := getNRGBABuf(4 * b.Dx() * b.Dy())
+	defer nrgbaPool.Put(&buf)
+	return e.enc.Encode(w, g.ToNRGBA(buf))
+}
+
+// Save encodes img into filename.
+func (e *PNGEncoder) Save(img image.Image, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := e.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func getNRGBABuf(n int) []byte {
+	if bp, ok := nrgbaPool.Get().(*[]byte); ok && cap(*bp) >= n {
+		return (*bp)[:n]
+	}
+	return make([]byte, n)
+}
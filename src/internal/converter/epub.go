@@ -0,0 +1,303 @@
+package converter
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/merridan/sngo/internal/note"
+)
+
+// Fixed-layout EPUB 3 output. Every page is an XHTML document whose viewport
+// matches the page image, so e-readers show pages as they look on the device,
+// landscape pages included.
+// The table of contents comes from the device titles, the package metadata
+// from the note header.
+
+// EPUBOptions describes the book being written.
+type EPUBOptions struct {
+	Title    string        // book title, usually the note name
+	Modified time.Time     // source modification time (dcterms:modified)
+	Sizes    []image.Point // size of each page image in pixels, in order
+	Pages    []int         // 0-based index of each page in the note; nil for all pages
+}
+
+// WriteEPUB writes nb as a fixed-layout EPUB 3. pages holds each page
+// encoded as PNG, in order; titles on pages left out are dropped from the
+// table of contents.
+func WriteEPUB(w io.Writer, nb *note.Notebook, opts EPUBOptions, pages [][]byte) error {
+	if len(pages) == 0 {
+		return fmt.Errorf("epub: no pages")
+	}
+	if len(opts.Sizes) != len(pages) {
+		return fmt.Errorf("epub: %d page sizes for %d pages", len(opts.Sizes), len(pages))
+	}
+	book := epubBook{EPUBOptions: opts, ID: epubIdentifier(nb, opts.Title), Language: "und"}
+	included := map[int]bool{}
+	orientations := map[string]bool{}
+	for i := range pages {
+		pageNum := i
+		if opts.Pages != nil {
+			pageNum = opts.Pages[i]
+		}
+		included[pageNum] = true
+		page := epubPageInfo{Num: pageNum + 1, Width: opts.Sizes[i].X, Height: opts.Sizes[i].Y, Orientation: "portrait"}
+		if page.Width > page.Height {
+			page.Orientation = "landscape"
+		}
+		orientations[page.Orientation] = true
+		book.Pages = append(book.Pages, page)
+	}
+	// Mixed books let the reader rotate; each page then names its own orientation
+	book.Orientation = book.Pages[0].Orientation
+	if len(orientations) > 1 {
+		book.Orientation = "auto"
+	}
+	outline, _ := Outline(nb, opts.Title)
+	var toc []OutlineEntry
+	for _, o := range outline {
+		if included[o.Page] {
+			toc = append(toc, o)
+		}
+	}
+	book.TOC = nestOutline(toc)
+	if lang := nb.Header["FILE_RECOGN_LANGUAGE"]; lang != "" && lang != "none" {
+		book.Language = strings.ReplaceAll(lang, "_", "-")
+	}
+	if created := nb.FileID.CreatedAt(); !created.IsZero() {
+		book.Created = created.UTC().Format(time.RFC3339)
+	}
+	book.Device = nb.Header["APPLY_EQUIPMENT"]
+	modified := opts.Modified
+	if modified.IsZero() {
+		modified = time.Now()
+	}
+	book.ModifiedStamp = modified.UTC().Format("2006-01-02T15:04:05Z")
+
+	zw := zip.NewWriter(w)
+	create := func(name string, method uint16) (io.Writer, error) {
+		return zw.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: modified})
+	}
+	// The mimetype entry must come first and be stored uncompressed.
+	mw, err := create("mimetype", zip.Store)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mw, "application/epub+zip"); err != nil {
+		return err
+	}
+	files := []struct {
+		name string
+		tmpl *template.Template
+		data any
+	}{
+		{"META-INF/container.xml", epubContainer, nil},
+		{"OEBPS/content.opf", epubPackage, book},
+		{"OEBPS/nav.xhtml", epubNav, book},
+	}
+	for _, f := range files {
+		fw, err := create(f.name, zip.Deflate)
+		if err != nil {
+			return err
+		}
+		if err := f.tmpl.Execute(fw, f.data); err != nil {
+			return fmt.Errorf("epub: %s: %w", f.name, err)
+		}
+	}
+	for i, data := range pages {
+		page := book.Pages[i]
+		fw, err := create(fmt.Sprintf("OEBPS/page_%03d.xhtml", page.Num), zip.Deflate)
+		if err != nil {
+			return err
+		}
+		if err := epubPage.Execute(fw, struct {
+			epubBook
+			Page epubPageInfo
+		}{book, page}); err != nil {
+			return err
+		}
+		// PNG data is already compressed.
+		iw, err := create(fmt.Sprintf("OEBPS/images/page_%03d.png", page.Num), zip.Store)
+		if err != nil {
+			return err
+		}
+		if _, err := iw.Write(data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// epubIdentifier derives a stable book identifier from the note's FILE_ID, so
+// re-exports of the same note replace each other in reading apps. Notes from
+// firmware without FILE_IDs get one hashed from the first page's ID, which is
+// kept when the note is renamed or pages are added after it; it changes only
+// if that page is deleted or moved. Notes without page IDs fall back to a
+// hash of the title, which changes when the note is renamed.
+func epubIdentifier(nb *note.Notebook, title string) string {
+	if nb.FileID != "" {
+		return "urn:supernote:" + string(nb.FileID)
+	}
+	seed := "title:" + title
+	if len(nb.Pages) > 0 && nb.Pages[0].ID() != "" {
+		seed = "page:" + string(nb.Pages[0].ID())
+	}
+	sum := sha256.Sum256([]byte(seed))
+	return "urn:supernote:sha256:" + hex.EncodeToString(sum[:])[:32]
+}
+
+type epubBook struct {
+	EPUBOptions
+	ID            string
+	Language      string
+	Created       string
+	Device        string
+	ModifiedStamp string
+	Orientation   string // rendition:orientation of the book
+	Pages         []epubPageInfo
+	TOC           []*epubNavItem
+}
+
+// epubPageInfo is one page of the book: its 1-based number in the note and
+// the size of its image.
+type epubPageInfo struct {
+	Num           int
+	Width, Height int
+	Orientation   string
+}
+
+// epubNavItem is a table of contents entry with the lower-level titles that
+// follow it nested underneath, as EPUB navigation documents require.
+type epubNavItem struct {
+	OutlineEntry
+	Children []*epubNavItem
+}
+
+// nestOutline turns the flat, page-ordered outline into a tree: each title
+// becomes a child of the closest preceding title with a smaller level.
+func nestOutline(outline []OutlineEntry) []*epubNavItem {
+	var roots []*epubNavItem
+	var stack []*epubNavItem
+	for _, o := range outline {
+		item := &epubNavItem{OutlineEntry: o}
+		for len(stack) > 0 && stack[len(stack)-1].Level >= o.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			roots = append(roots, item)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, item)
+		}
+		stack = append(stack, item)
+	}
+	return roots
+}
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+var epubFuncs = template.FuncMap{
+	"x":        xmlEscape,
+	"inc":      func(i int) int { return i + 1 },
+	"pagefile": func(p int) string { return fmt.Sprintf("page_%03d.xhtml", p) },
+	"imgfile":  func(p int) string { return fmt.Sprintf("images/page_%03d.png", p) },
+}
+
+var epubContainer = template.Must(template.New("container").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`))
+
+var epubPackage = template.Must(template.New("package").Funcs(epubFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" prefix="rendition: http://www.idpf.org/vocab/rendition/#">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">{{x .ID}}</dc:identifier>
+    <dc:title>{{x .Title}}</dc:title>
+    <dc:language>{{x .Language}}</dc:language>
+{{- if .Created}}
+    <dc:date>{{.Created}}</dc:date>
+{{- end}}
+{{- if .Device}}
+    <dc:source>Supernote {{x .Device}}</dc:source>
+{{- end}}
+    <meta property="dcterms:modified">{{.ModifiedStamp}}</meta>
+    <meta property="rendition:layout">pre-paginated</meta>
+    <meta property="rendition:orientation">{{.Orientation}}</meta>
+    <meta property="rendition:spread">none</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+{{- range $i, $p := .Pages}}
+    <item id="page-{{$p.Num}}" href="{{pagefile $p.Num}}" media-type="application/xhtml+xml"/>
+    <item id="image-{{$p.Num}}" href="{{imgfile $p.Num}}" media-type="image/png"{{if eq $i 0}} properties="cover-image"{{end}}/>
+{{- end}}
+  </manifest>
+  <spine>
+{{- range .Pages}}
+    <itemref idref="page-{{.Num}}"{{if eq $.Orientation "auto"}} properties="rendition:orientation-{{.Orientation}}"{{end}}/>
+{{- end}}
+  </spine>
+</package>
+`))
+
+var epubNav = template.Must(template.New("nav").Funcs(epubFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="{{x .Language}}" xml:lang="{{x .Language}}">
+<head><title>{{x .Title}}</title></head>
+<body>
+  <nav epub:type="toc" id="toc">
+    <h1>{{x .Title}}</h1>
+{{- if .TOC}}
+{{template "toc" .TOC}}
+{{- else}}
+    <ol>
+{{- range .Pages}}
+      <li><a href="{{pagefile .Num}}">Page {{.Num}}</a></li>
+{{- end}}
+    </ol>
+{{- end}}
+  </nav>
+  <nav epub:type="page-list" hidden="">
+    <ol>
+{{- range .Pages}}
+      <li><a href="{{pagefile .Num}}">{{.Num}}</a></li>
+{{- end}}
+    </ol>
+  </nav>
+</body>
+</html>
+{{define "toc"}}<ol>
+{{- range .}}
+<li><a href="{{pagefile (inc .Page)}}">{{x .Text}}</a>{{if .Children}}{{template "toc" .Children}}{{end}}</li>
+{{- end}}
+</ol>{{end}}
+`))
+
+var epubPage = template.Must(template.New("page").Funcs(epubFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="{{x .Language}}" xml:lang="{{x .Language}}">
+<head>
+  <title>{{x .Title}} – page {{.Page.Num}}</title>
+  <meta name="viewport" content="width={{.Page.Width}}, height={{.Page.Height}}"/>
+  <style>html, body { margin: 0; padding: 0; } img { display: block; width: {{.Page.Width}}px; height: {{.Page.Height}}px; }</style>
+</head>
+<body>
+  <img src="{{imgfile .Page.Num}}" alt="Page {{.Page.Num}}"/>
+</body>
+</html>
+`))
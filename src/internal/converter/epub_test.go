@@ -0,0 +1,170 @@
+package converter
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"image"
+	"io"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/merridan/sngo/internal/note"
+)
+
+func TestWriteEPUB(t *testing.T) {
+	nb := openExample(t)
+	var buf bytes.Buffer
+	opts := EPUBOptions{Title: "A & B", Modified: time.Date(2025, 9, 1, 8, 0, 0, 0, time.UTC), Sizes: []image.Point{{1404, 1872}}}
+	if err := WriteEPUB(&buf, nb, opts, [][]byte{[]byte("png data")}); err != nil {
+		t.Fatalf("WriteEPUB failed: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("not a zip: %v", err)
+	}
+	first := zr.File[0]
+	if first.Name != "mimetype" || first.Method != zip.Store {
+		t.Fatalf("Expected stored mimetype entry first, got %s (method %d)", first.Name, first.Method)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+	if files["mimetype"] != "application/epub+zip" {
+		t.Errorf("mimetype = %q", files["mimetype"])
+	}
+	for name, data := range files {
+		if strings.HasSuffix(name, ".xml") || strings.HasSuffix(name, ".opf") || strings.HasSuffix(name, ".xhtml") {
+			d := xml.NewDecoder(strings.NewReader(data))
+			for {
+				if _, err := d.Token(); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("%s is not well-formed: %v", name, err)
+				}
+			}
+		}
+	}
+
+	var pkg struct {
+		Manifest []struct {
+			ID   string `xml:"id,attr"`
+			Href string `xml:"href,attr"`
+		} `xml:"manifest>item"`
+		Spine []struct {
+			IDRef string `xml:"idref,attr"`
+		} `xml:"spine>itemref"`
+	}
+	if err := xml.Unmarshal([]byte(files["OEBPS/content.opf"]), &pkg); err != nil {
+		t.Fatalf("bad package document: %v", err)
+	}
+	ids := map[string]bool{}
+	for _, item := range pkg.Manifest {
+		ids[item.ID] = true
+		if _, ok := files[path.Join("OEBPS", item.Href)]; !ok {
+			t.Errorf("manifest item %s missing from archive", item.Href)
+		}
+	}
+	if len(pkg.Spine) != 1 || !ids[pkg.Spine[0].IDRef] {
+		t.Errorf("Expected one spine item in the manifest, got %+v", pkg.Spine)
+	}
+	opf := files["OEBPS/content.opf"]
+	for _, want := range []string{
+		"urn:supernote:" + string(nb.FileID),
+		"<dc:title>A &amp; B</dc:title>",
+		"<dc:language>und</dc:language>",
+		"<dc:date>2025-08-29T",
+		`<meta property="dcterms:modified">2025-09-01T08:00:00Z</meta>`,
+		`<meta property="rendition:layout">pre-paginated</meta>`,
+		`<meta property="rendition:orientation">portrait</meta>`,
+	} {
+		if !strings.Contains(opf, want) {
+			t.Errorf("Expected package document to contain %q, got:\n%s", want, opf)
+		}
+	}
+	if page := files["OEBPS/page_001.xhtml"]; !strings.Contains(page, `content="width=1404, height=1872"`) {
+		t.Errorf("Expected viewport on page document, got:\n%s", page)
+	}
+	if nav := files["OEBPS/nav.xhtml"]; !strings.Contains(nav, `<a href="page_001.xhtml">Page 1</a>`) {
+		t.Errorf("Expected page entry in nav without titles, got:\n%s", nav)
+	}
+}
+
+func TestWriteEPUBMixedOrientation(t *testing.T) {
+	nb := openExample(t)
+	nb.FileID = ""
+	var buf bytes.Buffer
+	opts := EPUBOptions{Title: "mixed", Sizes: []image.Point{{1404, 1872}, {1872, 1404}}}
+	if err := WriteEPUB(&buf, nb, opts, [][]byte{[]byte("portrait"), []byte("landscape")}); err != nil {
+		t.Fatalf("WriteEPUB failed: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("not a zip: %v", err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+	opf := files["OEBPS/content.opf"]
+	for _, want := range []string{
+		`<meta property="rendition:orientation">auto</meta>`,
+		`<itemref idref="page-1" properties="rendition:orientation-portrait"/>`,
+		`<itemref idref="page-2" properties="rendition:orientation-landscape"/>`,
+		epubIdentifier(nb, "mixed"),
+	} {
+		if !strings.Contains(opf, want) {
+			t.Errorf("Expected package document to contain %q, got:\n%s", want, opf)
+		}
+	}
+	if page := files["OEBPS/page_002.xhtml"]; !strings.Contains(page, `content="width=1872, height=1404"`) {
+		t.Errorf("Expected the landscape page's own viewport, got:\n%s", page)
+	}
+
+	// Without a FILE_ID the identifier follows the first page, so it survives
+	// renames and added pages, while other notes get their own
+	id := epubIdentifier(nb, "a")
+	if !strings.HasPrefix(id, "urn:supernote:sha256:") || epubIdentifier(nb, "b") != id {
+		t.Errorf("Expected one hashed identifier across renames, got %q and %q", id, epubIdentifier(nb, "b"))
+	}
+	grown := &note.Notebook{Pages: append(append([]note.PageMeta(nil), nb.Pages...), note.PageMeta{Params: map[string]string{"PAGEID": "P2"}})}
+	if got := epubIdentifier(grown, "a"); got != id {
+		t.Errorf("Expected adding a page to keep the identifier %q, got %q", id, got)
+	}
+	other := &note.Notebook{Pages: []note.PageMeta{{Params: map[string]string{"PAGEID": "P1"}}}}
+	if got := epubIdentifier(other, "a"); got == id {
+		t.Errorf("Expected another note to get its own identifier, got %q", got)
+	}
+	noIDs := &note.Notebook{Pages: []note.PageMeta{{}}}
+	if a, b := epubIdentifier(noIDs, "a"), epubIdentifier(noIDs, "b"); a == b {
+		t.Errorf("Expected notes without page IDs to be told apart by title, got %q twice", a)
+	}
+}
+
+func TestNestOutline(t *testing.T) {
+	toc := nestOutline([]OutlineEntry{
+		{Page: 0, Level: 1, Text: "a"},
+		{Page: 0, Level: 2, Text: "a.1"},
+		{Page: 1, Level: 3, Text: "a.1.1"},
+		{Page: 1, Level: 2, Text: "a.2"},
+		{Page: 2, Level: 1, Text: "b"},
+	})
+	if len(toc) != 2 || toc[0].Text != "a" || toc[1].Text != "b" {
+		t.Fatalf("Expected roots a and b, got %+v", toc)
+	}
+	if len(toc[0].Children) != 2 || len(toc[0].Children[0].Children) != 1 || toc[0].Children[1].Text != "a.2" {
+		t.Errorf("Unexpected nesting under a: %+v", toc[0].Children)
+	}
+}
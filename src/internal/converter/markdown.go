@@ -0,0 +1,146 @@
+package converter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/merridan/sngo/internal/logging"
+	"github.com/merridan/sngo/internal/note"
+)
+
+// MarkdownOptions describes the files generated alongside a notebook's Markdown.
+type MarkdownOptions struct {
+	Name      string           // note name; the document heading and wiki link target
+	PageImage func(int) string // path of a page image relative to the Markdown file
+	Modified  time.Time        // source modification time
+	Pages     []int            // 0-based pages to include; nil for all pages
+}
+
+// WriteMarkdown writes a vault-friendly Markdown document for nb: YAML front
+// matter (FILE_ID, creation time, page count, keywords as tags), the device
+// titles as headings, each page image followed by its recognized text, and
+// links to other notes as [[wiki links]].
+func WriteMarkdown(w io.Writer, nb *note.Notebook, opts MarkdownOptions) error {
+	outline, pageText := Outline(nb, opts.Name)
+	links, err := nb.Links()
+	if err != nil {
+		logging.Warn("%s: links unavailable: %v", opts.Name, err)
+	}
+
+	bw := bufio.NewWriter(w)
+	writeFrontMatter(bw, nb, opts, KeywordTexts(nb, opts.Name))
+	fmt.Fprintf(bw, "# %s\n", opts.Name)
+
+	pages := opts.Pages
+	if pages == nil {
+		for pageNum := range nb.Pages {
+			pages = append(pages, pageNum)
+		}
+	}
+	for _, pageNum := range pages {
+		for _, t := range outline {
+			if t.Page == pageNum {
+				// Level 1 is the note itself, so device levels start at ##.
+				fmt.Fprintf(bw, "\n%s %s\n", strings.Repeat("#", min(t.Level+1, 6)), t.Text)
+			}
+		}
+		fmt.Fprintf(bw, "\n![Page %d](%s)\n", pageNum+1, markdownPath(opts.PageImage(pageNum)))
+		if text := pageText[pageNum]; text != "" {
+			fmt.Fprintf(bw, "\n%s\n", text)
+		}
+		var pageLinks []string
+		for _, l := range links {
+			if l.Page == pageNum {
+				if s := markdownLink(nb, opts.Name, l); s != "" {
+					pageLinks = append(pageLinks, s)
+				}
+			}
+		}
+		if len(pageLinks) > 0 {
+			bw.WriteString("\n")
+			for _, s := range pageLinks {
+				fmt.Fprintf(bw, "- %s\n", s)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+func writeFrontMatter(w io.Writer, nb *note.Notebook, opts MarkdownOptions, keywords []string) {
+	fmt.Fprintln(w, "---")
+	fmt.Fprintf(w, "file_id: %s\n", yamlString(string(nb.FileID)))
+	if created := nb.FileID.CreatedAt(); !created.IsZero() {
+		fmt.Fprintf(w, "created: %s\n", created.Format(time.RFC3339))
+	}
+	if !opts.Modified.IsZero() {
+		fmt.Fprintf(w, "modified: %s\n", opts.Modified.Format(time.RFC3339))
+	}
+	fmt.Fprintf(w, "pages: %d\n", len(nb.Pages))
+	seen := map[string]bool{}
+	var tags []string
+	for _, kw := range keywords {
+		if tag := markdownTag(kw); tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > 0 {
+		fmt.Fprintln(w, "tags:")
+		for _, tag := range tags {
+			fmt.Fprintf(w, "  - %s\n", yamlString(tag))
+		}
+	}
+	fmt.Fprintln(w, "---")
+	fmt.Fprintln(w)
+}
+
+// markdownLink renders an outgoing link, or "" if it has no usable target.
+func markdownLink(nb *note.Notebook, name string, l note.Link) string {
+	switch {
+	case l.Type == note.LinkToWeb && l.Target != "":
+		return fmt.Sprintf("<%s>", l.Target)
+	case l.TargetFile != "" && l.TargetFile == nb.FileID:
+		if p := nb.PageIndex(l.TargetPage); p >= 0 {
+			return fmt.Sprintf("[[%s|Page %d]]", name, p+1)
+		}
+		return ""
+	case l.Target != "":
+		target := path.Base(l.Target)
+		if strings.EqualFold(path.Ext(target), ".note") {
+			target = target[:len(target)-len(".note")]
+		}
+		return fmt.Sprintf("[[%s]]", target)
+	}
+	return ""
+}
+
+// markdownTag turns a keyword into a tag Obsidian and Logseq accept: no
+// leading '#', no whitespace.
+func markdownTag(s string) string {
+	s = strings.TrimLeft(strings.TrimSpace(s), "#")
+	return strings.Join(strings.Fields(s), "-")
+}
+
+// markdownPath percent-encodes each segment of an image path, so spaces,
+// parentheses, '<' and '#' in note names survive CommonMark parsing.
+func markdownPath(p string) string {
+	segments := strings.Split(path.Clean(strings.ReplaceAll(p, "\\", "/")), "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// yamlString quotes s when it would not survive as a plain YAML scalar.
+func yamlString(s string) string {
+	if s == "" || strings.ContainsAny(s, ":#{}[],&*!|>'\"%@`\n") || strings.TrimSpace(s) != s {
+		return strconv.Quote(s)
+	}
+	return s
+}
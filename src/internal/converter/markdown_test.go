@@ -0,0 +1,85 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/merridan/sngo/internal/note"
+)
+
+func TestWriteMarkdown(t *testing.T) {
+	nb := openExample(t)
+	var buf bytes.Buffer
+	err := WriteMarkdown(&buf, nb, MarkdownOptions{
+		Name:      "my note",
+		PageImage: func(p int) string { return fmt.Sprintf("my note/page_%03d.png", p) },
+	})
+	if err != nil {
+		t.Fatalf("WriteMarkdown failed: %v", err)
+	}
+	md := buf.String()
+	for _, want := range []string{
+		"---\nfile_id: " + string(nb.FileID) + "\n",
+		"created: 2025-08-29T17:06:23",
+		"pages: 1\n---\n",
+		"# my note\n",
+		"![Page 1](my%20note/page_000.png)",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Expected Markdown to contain %q, got:\n%s", want, md)
+		}
+	}
+}
+
+func TestMarkdownPath(t *testing.T) {
+	nb := openExample(t)
+	var buf bytes.Buffer
+	err := WriteMarkdown(&buf, nb, MarkdownOptions{
+		Name:      "Meeting (old)",
+		PageImage: func(p int) string { return fmt.Sprintf("Meeting (old)/page_%03d.png", p) },
+	})
+	if err != nil {
+		t.Fatalf("WriteMarkdown failed: %v", err)
+	}
+	if want := "![Page 1](Meeting%20%28old%29/page_000.png)"; !strings.Contains(buf.String(), want) {
+		t.Errorf("Expected Markdown to contain %q, got:\n%s", want, buf.String())
+	}
+	for in, want := range map[string]string{
+		`Work\a b\page_000.png`: "Work/a%20b/page_000.png",
+		"../x/<draft> #2.png":   "../x/%3Cdraft%3E%20%232.png",
+		"a)/b(.png":             "a%29/b%28.png",
+	} {
+		if got := markdownPath(in); got != want {
+			t.Errorf("markdownPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestMarkdownLinksAndTags(t *testing.T) {
+	nb := &note.Notebook{FileID: "F1", Pages: []note.PageMeta{
+		{Params: map[string]string{"PAGEID": "P1"}},
+		{Params: map[string]string{"PAGEID": "P2"}},
+	}}
+	cases := []struct {
+		link note.Link
+		want string
+	}{
+		{note.Link{Type: note.LinkToFile, Target: "/Note/Work/Plan.note"}, "[[Plan]]"},
+		{note.Link{Type: note.LinkToPage, Target: "/Note/Self.note", TargetFile: "F1", TargetPage: "P2"}, "[[self|Page 2]]"},
+		{note.Link{Type: note.LinkToWeb, Target: "https://example.com"}, "<https://example.com>"},
+		{note.Link{Type: note.LinkToFile}, ""},
+	}
+	for _, c := range cases {
+		if got := markdownLink(nb, "self", c.link); got != c.want {
+			t.Errorf("markdownLink(%+v) = %q, want %q", c.link, got, c.want)
+		}
+	}
+	if got := markdownTag(" #project x "); got != "project-x" {
+		t.Errorf("markdownTag = %q", got)
+	}
+	if got := yamlString("a: b"); got != `"a: b"` {
+		t.Errorf("yamlString = %q", got)
+	}
+}
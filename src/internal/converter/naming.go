@@ -0,0 +1,181 @@
+package converter
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultNameTemplate is the classic layout: a folder per note, mirroring the
+// input folders, with page_000.png, page_001.png, ... inside.
+const DefaultNameTemplate = "{dir}/{note}/page_{page}.{ext}"
+
+// Placeholders understood by name templates, see PageName. page and page1
+// take an optional zero-padding width, e.g. {page1:2}; the default is 3.
+var nameFields = []string{"created", "dir", "ext", "note", "page", "page1", "pageid", "title"}
+
+// PageName holds the values a name template is expanded with.
+type PageName struct {
+	Dir     string    // {dir}: slash-separated folder under the input, "" at the top level
+	Note    string    // {note}: note file name without extension
+	Page    int       // {page} is 0-based, {page1} 1-based
+	PageID  string    // {pageid}: the device's PAGEID
+	Title   string    // {title}: text of the first title on the page
+	Created time.Time // {created}: formatted as YYYY-MM-DD
+	Ext     string    // {ext}: extension of the output format, without the dot
+}
+
+// NameTemplate builds output paths like "{dir}/{note}/page_{page}.{ext}".
+type NameTemplate struct {
+	text  string
+	parts []namePart
+}
+
+// namePart is either literal text or a placeholder with its padding width.
+type namePart struct {
+	literal string
+	field   string
+	width   int
+}
+
+// ParseNameTemplate parses and validates a name template. Every template
+// must contain {note} and one of {page}, {page1} or {pageid}, so that two
+// pages of a notebook, or two notebooks, cannot be given the same path.
+func ParseNameTemplate(s string) (*NameTemplate, error) {
+	t := &NameTemplate{text: s}
+	rest := s
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if close := strings.IndexByte(rest, '}'); close >= 0 && (open < 0 || close < open) {
+			return nil, fmt.Errorf("name template %q: unmatched }", s)
+		}
+		if open < 0 {
+			t.parts = append(t.parts, namePart{literal: rest})
+			break
+		}
+		if open > 0 {
+			t.parts = append(t.parts, namePart{literal: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("name template %q: unmatched {", s)
+		}
+		p, err := parseNameField(rest[open+1 : open+end])
+		if err != nil {
+			return nil, fmt.Errorf("name template %q: %v", s, err)
+		}
+		t.parts = append(t.parts, p)
+		rest = rest[open+end+1:]
+	}
+
+	if strings.HasPrefix(s, "/") {
+		return nil, fmt.Errorf("name template %q must be relative to the output directory", s)
+	}
+	for _, p := range t.parts {
+		for _, seg := range strings.Split(p.literal, "/") {
+			if seg == ".." {
+				return nil, fmt.Errorf("name template %q must not leave the output directory", s)
+			}
+		}
+	}
+	if !t.Uses("note") {
+		return nil, fmt.Errorf("name template %q must contain {note}, or pages of different notes would share names", s)
+	}
+	if !t.Uses("page") && !t.Uses("page1") && !t.Uses("pageid") {
+		return nil, fmt.Errorf("name template %q must contain {page}, {page1} or {pageid}, or pages of a note would share names", s)
+	}
+	return t, nil
+}
+
+func parseNameField(s string) (namePart, error) {
+	name, width, hasWidth := strings.Cut(s, ":")
+	if !slices.Contains(nameFields, name) {
+		return namePart{}, fmt.Errorf("unknown placeholder {%s} (want one of {%s})", s, strings.Join(nameFields, "}, {"))
+	}
+	p := namePart{field: name}
+	if name == "page" || name == "page1" {
+		p.width = 3
+	}
+	if hasWidth {
+		w, err := strconv.Atoi(width)
+		if err != nil || w < 0 || w > 9 || p.width == 0 {
+			return namePart{}, fmt.Errorf("invalid width in {%s}", s)
+		}
+		p.width = w
+	}
+	return p, nil
+}
+
+// Uses reports whether the template contains the placeholder {field}.
+func (t *NameTemplate) Uses(field string) bool {
+	for _, p := range t.parts {
+		if p.field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *NameTemplate) String() string { return t.text }
+
+// NoteFolders reports whether {note} appears in a folder of the path, so
+// every note gets folders of its own.
+func (t *NameTemplate) NoteFolders() bool {
+	note := false
+	for _, p := range t.parts {
+		if p.field == "note" {
+			note = true
+		}
+		if note && strings.Contains(p.literal, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Expand returns the slash-separated path of a page relative to the output
+// directory. Values other than {dir} are made safe as a single path element.
+func (t *NameTemplate) Expand(n PageName) string {
+	var b strings.Builder
+	for _, p := range t.parts {
+		switch p.field {
+		case "":
+			b.WriteString(p.literal)
+		case "dir":
+			b.WriteString(n.Dir)
+		case "note":
+			b.WriteString(safeNameElem(n.Note))
+		case "page":
+			fmt.Fprintf(&b, "%0*d", p.width, n.Page)
+		case "page1":
+			fmt.Fprintf(&b, "%0*d", p.width, n.Page+1)
+		case "pageid":
+			b.WriteString(safeNameElem(n.PageID))
+		case "title":
+			b.WriteString(safeNameElem(n.Title))
+		case "created":
+			if !n.Created.IsZero() {
+				b.WriteString(n.Created.Format("2006-01-02"))
+			}
+		case "ext":
+			b.WriteString(n.Ext)
+		}
+	}
+	// An empty {dir} must not turn "{dir}/x" into an absolute path
+	return strings.TrimPrefix(path.Clean("/"+b.String()), "/")
+}
+
+// safeNameElem replaces characters that are not allowed in file names on
+// common file systems, so a title like "Q3/Q4: plan?" stays one element.
+func safeNameElem(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+	return strings.TrimRight(strings.TrimSpace(s), ".")
+}
@@ -0,0 +1,63 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNameTemplateExpand(t *testing.T) {
+	n := PageName{
+		Dir:     "Work/2025",
+		Note:    "Plan",
+		Page:    4,
+		PageID:  "P2025",
+		Title:   "Q3/Q4: goals?",
+		Created: time.Date(2025, 8, 29, 17, 6, 0, 0, time.UTC),
+		Ext:     "png",
+	}
+	cases := []struct{ tmpl, want string }{
+		{DefaultNameTemplate, "Work/2025/Plan/page_004.png"},
+		{"{dir}/{note}_{page1:0}.{ext}", "Work/2025/Plan_5.png"},
+		{"{created}/{note}-{pageid}-{title}.{ext}", "2025-08-29/Plan-P2025-Q3_Q4_ goals_.png"},
+	}
+	for _, c := range cases {
+		tmpl, err := ParseNameTemplate(c.tmpl)
+		if err != nil {
+			t.Fatalf("ParseNameTemplate(%q) failed: %v", c.tmpl, err)
+		}
+		if got := tmpl.Expand(n); got != c.want {
+			t.Errorf("Expand(%q) = %q, want %q", c.tmpl, got, c.want)
+		}
+	}
+
+	// Notes at the top level have no folder
+	tmpl, _ := ParseNameTemplate(DefaultNameTemplate)
+	n.Dir = ""
+	if got := tmpl.Expand(n); got != "Plan/page_004.png" {
+		t.Errorf("Expand with empty dir = %q", got)
+	}
+	if !tmpl.NoteFolders() {
+		t.Error("Expected the default template to give every note its own folder")
+	}
+}
+
+func TestParseNameTemplateErrors(t *testing.T) {
+	for tmpl, want := range map[string]string{
+		"{dir}/{note}/page_{page.{ext}":   "unknown placeholder",
+		"{dir}/{note}/page_{page}}.{ext}": "unmatched }",
+		"{dir}/{note}/page_{page}.{ext":   "unmatched {",
+		"{dir}/{note}.{ext}":              "must contain {page}",
+		"{dir}/page_{page}.{ext}":         "must contain {note}",
+		"{dir}/../{note}_{page}.png":      "must not leave",
+		"/tmp/{note}_{page}.png":          "must be relative",
+		"{note}_{page:x}.png":             "invalid width",
+		"{note:2}_{page}.png":             "invalid width",
+		"{note}_{nope}_{page}.png":        "unknown placeholder",
+	} {
+		_, err := ParseNameTemplate(tmpl)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseNameTemplate(%q) error = %v, want %q", tmpl, err, want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package converter
+
+import (
+	"fmt"
+
+	"github.com/merridan/sngo/internal/logging"
+	"github.com/merridan/sngo/internal/note"
+)
+
+// OutlineEntry is a device title labelled with its recognized text.
+type OutlineEntry struct {
+	Page  int // 0-based page index
+	Level int // 1 (largest) .. 4
+	Text  string
+}
+
+// Outline returns the notebook's titles in page order and each page's
+// recognized text. Titles the device has not recognized are labelled
+// "Untitled (page N)". Metadata errors are logged, not returned, so a damaged
+// footer never stops page output.
+func Outline(nb *note.Notebook, name string) ([]OutlineEntry, []string) {
+	titles, err := nb.Titles()
+	if err != nil {
+		logging.Warn("%s: titles unavailable: %v", name, err)
+	}
+	pageText := make([]string, len(nb.Pages))
+	var outline []OutlineEntry
+	for pageNum := range nb.Pages {
+		text, words, err := nb.RecognizedText(pageNum)
+		if err != nil {
+			logging.Warn("%s: page %d: %v", name, pageNum+1, err)
+		}
+		pageText[pageNum] = text
+		for _, t := range titles {
+			if t.Page != pageNum {
+				continue
+			}
+			label := note.TextIn(words, t.Rect)
+			if label == "" {
+				label = fmt.Sprintf("Untitled (page %d)", pageNum+1)
+			}
+			outline = append(outline, OutlineEntry{Page: pageNum, Level: t.Level, Text: label})
+		}
+	}
+	return outline, pageText
+}
+
+// KeywordTexts returns the notebook's distinct keywords in page order.
+func KeywordTexts(nb *note.Notebook, name string) []string {
+	keywords, err := nb.Keywords()
+	if err != nil {
+		logging.Warn("%s: keywords unavailable: %v", name, err)
+	}
+	seen := map[string]bool{}
+	var out []string
+	for _, kw := range keywords {
+		if !seen[kw.Text] {
+			seen[kw.Text] = true
+			out = append(out, kw.Text)
+		}
+	}
+	return out
+}
@@ -0,0 +1,151 @@
+package converter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PageSpec is a parsed page specification, see ParsePageSpec.
+type PageSpec struct {
+	text     string
+	items    []pageItem
+	oneBased bool
+}
+
+// pageItem is one comma-separated element of a spec. Page numbers are kept as
+// written; they are resolved against a notebook's page count by Pages.
+type pageItem struct {
+	text       string
+	kind       string // "all", "odd", "even", "page" or "range"
+	start, end int
+	openEnd    bool // "5-": the range runs to the last page
+}
+
+// ParsePageSpec parses a comma-separated list of:
+//
+//	*, all     every page; so is an empty spec, but not an empty item
+//	odd, even  pages 1, 3, 5, ... or 2, 4, 6, ... as numbered on the device
+//	3          a single page
+//	2-5        a range, inclusive
+//	5-         page 5 to the last page
+//	-1         a page counted from the end: -1 is the last page
+//	-5-        the last five pages; negative numbers work in ranges too (-5--2)
+//
+// Page numbers count from 0, or from 1 when oneBased is set; negative numbers
+// are the same in both modes.
+func ParsePageSpec(spec string, oneBased bool) (*PageSpec, error) {
+	s := &PageSpec{text: spec, oneBased: oneBased}
+	if strings.TrimSpace(spec) == "" {
+		s.items = []pageItem{{kind: "all"}}
+		return s, nil
+	}
+	for _, text := range strings.Split(spec, ",") {
+		text = strings.TrimSpace(text)
+		item := pageItem{text: text}
+		switch text {
+		case "":
+			return nil, fmt.Errorf("page spec %q: empty item", spec)
+		case "*", "all":
+			item.kind = "all"
+		case "odd", "even":
+			item.kind = text
+		default:
+			// A leading '-' is a sign, so the range separator is the first '-' after it
+			sep := strings.IndexByte(text[1:], '-') + 1
+			var err error
+			if sep == 0 {
+				item.kind = "page"
+				item.start, err = s.parsePage(text)
+			} else {
+				item.kind = "range"
+				if item.start, err = s.parsePage(text[:sep]); err == nil {
+					if rest := text[sep+1:]; rest == "" {
+						item.openEnd = true
+					} else {
+						item.end, err = s.parsePage(rest)
+					}
+				}
+			}
+			if err != nil {
+				return nil, fmt.Errorf("page spec %q: %v", spec, err)
+			}
+		}
+		s.items = append(s.items, item)
+	}
+	return s, nil
+}
+
+func (s *PageSpec) parsePage(text string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(text))
+	if err != nil {
+		return 0, fmt.Errorf("invalid page number %q", text)
+	}
+	if s.oneBased && n == 0 {
+		return 0, fmt.Errorf("page numbers start at 1")
+	}
+	return n, nil
+}
+
+func (s *PageSpec) String() string { return s.text }
+
+// Pages returns the selected 0-based page indexes of a notebook with
+// totalPages pages, sorted and without duplicates. A single page that does
+// not exist is an error, while ranges are clipped to the pages the note has,
+// so "-7-" selects the last week of a journal however long it is.
+func (s *PageSpec) Pages(totalPages int) ([]int, error) {
+	selected := make([]bool, totalPages)
+	for _, item := range s.items {
+		switch item.kind {
+		case "all":
+			for i := range selected {
+				selected[i] = true
+			}
+		case "odd", "even":
+			first := 0
+			if item.kind == "even" {
+				first = 1
+			}
+			for i := first; i < totalPages; i += 2 {
+				selected[i] = true
+			}
+		case "page":
+			page := s.index(item.start, totalPages)
+			if page < 0 || page >= totalPages {
+				return nil, fmt.Errorf("page %s does not exist (note has %d pages)", item.text, totalPages)
+			}
+			selected[page] = true
+		case "range":
+			start, end := s.index(item.start, totalPages), totalPages-1
+			if !item.openEnd {
+				end = s.index(item.end, totalPages)
+			}
+			if start > end {
+				return nil, fmt.Errorf("range %s ends before it starts", item.text)
+			}
+			for i := max(start, 0); i <= end && i < totalPages; i++ {
+				selected[i] = true
+			}
+		}
+	}
+
+	var pages []int
+	for i, ok := range selected {
+		if ok {
+			pages = append(pages, i)
+		}
+	}
+	return pages, nil
+}
+
+// index converts a page number of the spec to a 0-based index, which may be
+// out of range.
+func (s *PageSpec) index(n, totalPages int) int {
+	switch {
+	case n < 0:
+		return totalPages + n
+	case s.oneBased:
+		return n - 1
+	}
+	return n
+}
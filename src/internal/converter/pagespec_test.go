@@ -0,0 +1,75 @@
+package converter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePageSpec(t *testing.T) {
+	cases := []struct {
+		spec     string
+		oneBased bool
+		want     []int
+	}{
+		{"", false, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{"*", false, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{"3", false, []int{3}},
+		{"3", true, []int{2}},
+		{"2-4, 0", false, []int{0, 2, 3, 4}},
+		{"2-4", true, []int{1, 2, 3}},
+		{"7-", false, []int{7, 8, 9}},
+		{"-1", false, []int{9}},
+		{"-1", true, []int{9}},
+		{"-3-", false, []int{7, 8, 9}},
+		{"-3--2", false, []int{7, 8}},
+		{"-20-", false, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{"5-30", true, []int{4, 5, 6, 7, 8, 9}},
+		{"odd", false, []int{0, 2, 4, 6, 8}},
+		{"even", true, []int{1, 3, 5, 7, 9}},
+		{"odd,-1", false, []int{0, 2, 4, 6, 8, 9}},
+	}
+	for _, c := range cases {
+		spec, err := ParsePageSpec(c.spec, c.oneBased)
+		if err != nil {
+			t.Errorf("ParsePageSpec(%q, oneBased=%v) failed: %v", c.spec, c.oneBased, err)
+			continue
+		}
+		got, err := spec.Pages(10)
+		if err != nil {
+			t.Errorf("ParsePageSpec(%q, oneBased=%v) failed: %v", c.spec, c.oneBased, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParsePageSpec(%q, oneBased=%v) = %v, want %v", c.spec, c.oneBased, got, c.want)
+		}
+	}
+}
+
+func TestParsePageSpecErrors(t *testing.T) {
+	for _, c := range []struct {
+		spec     string
+		oneBased bool
+	}{
+		{"0", true},
+		{"x", false},
+		{"1-x", false},
+		{"1-2-3", false},
+		{"3,", false},
+		{"1,,2", false},
+		{" , ", false},
+	} {
+		if _, err := ParsePageSpec(c.spec, c.oneBased); err == nil {
+			t.Errorf("ParsePageSpec(%q, oneBased=%v) should fail", c.spec, c.oneBased)
+		}
+	}
+	// Valid specs that do not fit a 10-page note
+	for _, text := range []string{"10", "-11", "4-2", "3--8"} {
+		spec, err := ParsePageSpec(text, false)
+		if err != nil {
+			t.Fatalf("ParsePageSpec(%q) failed: %v", text, err)
+		}
+		if _, err := spec.Pages(10); err == nil {
+			t.Errorf("Pages for %q should fail", text)
+		}
+	}
+}
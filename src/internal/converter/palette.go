@@ -0,0 +1,106 @@
+package converter
+
+import (
+	"image"
+	"image/color"
+	"sort"
+	"sync"
+
+	"github.com/merridan/sngo/internal/note"
+)
+
+// maxPaletteColors is the largest palette png.Encode still writes at 4 bits per pixel.
+// Device pages use the grayLUT levels (0x00, 0x9d, 0xc9, 0xfe) plus transparency,
+// so they normally fit in 2 bits.
+const maxPaletteColors = 16
+
+// palettedPool recycles w*h index buffers for paletted output.
+var palettedPool sync.Pool
+
+// ToPaletted maps g onto a palette holding exactly the (gray, alpha) pairs it
+// uses, so the result decodes back to the same pixels. It returns false when
+// the page uses more than maxPaletteColors values and cannot be stored
+// losslessly at 4 bits. buf is reused for the indices when large enough.
+func ToPaletted(g *note.GrayImage, buf []byte) (*image.Paletted, bool) {
+	r := g.Bounds()
+	w, h := r.Dx(), r.Dy()
+	pix, alpha := g.Pix(), g.Alpha()
+	key := func(i int) uint16 {
+		a := uint16(255)
+		if alpha != nil {
+			a = uint16(alpha[i])
+		}
+		return a<<8 | uint16(pix[i])
+	}
+
+	// First pass: collect the distinct values (runs are long, so skip repeats cheaply)
+	seen := map[uint16]bool{}
+	last := -1
+	for y := 0; y < h; y++ {
+		row := g.PixOffset(r.Min.X, r.Min.Y+y)
+		for i := row; i < row+w; i++ {
+			k := int(key(i))
+			if k == last {
+				continue
+			}
+			last = k
+			if !seen[uint16(k)] {
+				if len(seen) == maxPaletteColors {
+					return nil, false
+				}
+				seen[uint16(k)] = true
+			}
+		}
+	}
+
+	// Stable ordering: opaque levels dark to light, then translucent entries
+	keys := make([]uint16, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ai, aj := keys[i]>>8, keys[j]>>8
+		if ai != aj {
+			return ai > aj
+		}
+		return keys[i]&0xff < keys[j]&0xff
+	})
+	pal := make(color.Palette, len(keys))
+	index := make(map[uint16]uint8, len(keys))
+	for i, k := range keys {
+		v, a := uint8(k), uint8(k>>8)
+		if a == 255 {
+			pal[i] = color.Gray{Y: v}
+		} else {
+			pal[i] = color.NRGBA{R: v, G: v, B: v, A: a}
+		}
+		index[k] = uint8(i)
+	}
+
+	// Second pass: write indices
+	if cap(buf) < w*h {
+		buf = make([]byte, w*h)
+	}
+	out := &image.Paletted{Pix: buf[:w*h], Stride: w, Rect: r, Palette: pal}
+	last = -1
+	var cur uint8
+	for y := 0; y < h; y++ {
+		row := g.PixOffset(r.Min.X, r.Min.Y+y)
+		dst := out.Pix[y*w : (y+1)*w]
+		for x := range dst {
+			if k := int(key(row + x)); k != last {
+				last = k
+				cur = index[uint16(k)]
+			}
+			dst[x] = cur
+		}
+	}
+	return out, true
+}
+
+func getPalettedBuf(n int) []byte {
+	if bp, ok := palettedPool.Get().(*[]byte); ok && cap(*bp) >= n {
+		return (*bp)[:n]
+	}
+	return make([]byte, n)
+}
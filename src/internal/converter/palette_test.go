@@ -0,0 +1,63 @@
+package converter
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/merridan/sngo/internal/note"
+)
+
+func TestPalettedPNGIsLossless(t *testing.T) {
+	g := note.NewGrayImage(image.Rect(0, 0, 16, 4), true)
+	levels := []color.Color{
+		color.Gray{Y: 0x00}, color.Gray{Y: 0x9d}, color.Gray{Y: 0xc9}, color.Gray{Y: 0xfe},
+		color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0},
+	}
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 4; y++ {
+			g.Set(x, y, levels[(x+y)%len(levels)])
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := NewPNGEncoder(PNGOptions{Paletted: true}).Encode(&buf, g); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	// IHDR bit depth lives at byte 24 of the file
+	if depth := buf.Bytes()[24]; depth > 4 {
+		t.Errorf("Expected at most 4-bit PNG, got %d-bit", depth)
+	}
+	decoded, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("png.Decode failed: %v", err)
+	}
+	want := g.ToNRGBA(nil)
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 16; x++ {
+			got := color.NRGBAModel.Convert(decoded.At(x, y)).(color.NRGBA)
+			w := want.NRGBAAt(x, y)
+			if w.A == 0 {
+				if got.A != 0 {
+					t.Errorf("(%d,%d): expected transparent, got %v", x, y, got)
+				}
+				continue
+			}
+			if got != w {
+				t.Errorf("(%d,%d): expected %v, got %v", x, y, w, got)
+			}
+		}
+	}
+}
+
+func TestToPalettedRejectsTooManyLevels(t *testing.T) {
+	g := note.NewGrayImage(image.Rect(0, 0, 32, 1), false)
+	for x := 0; x < 32; x++ {
+		g.Set(x, 0, color.Gray{Y: uint8(x * 8)})
+	}
+	if _, ok := ToPaletted(g, nil); ok {
+		t.Errorf("Expected ToPaletted to refuse 32 gray levels")
+	}
+}
@@ -0,0 +1,187 @@
+package converter
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image/png"
+	"io"
+)
+
+// grayPNGWriter streams an 8-bit grayscale PNG row by row, so images far
+// larger than memory (a whole notebook stitched into one page) can be
+// written while only one row is held at a time.
+type grayPNGWriter struct {
+	w             io.Writer
+	width, height int
+	rows          int
+	idat          chunkWriter
+	zw            *zlib.Writer
+	prev, cur     []byte
+	filtered      [5][]byte
+}
+
+// pngZlibLevel maps a png.CompressionLevel to the zlib level image/png uses for it.
+func pngZlibLevel(l png.CompressionLevel) int {
+	switch l {
+	case png.NoCompression:
+		return zlib.NoCompression
+	case png.BestSpeed:
+		return zlib.BestSpeed
+	case png.BestCompression:
+		return zlib.BestCompression
+	default:
+		return zlib.DefaultCompression
+	}
+}
+
+func newGrayPNGWriter(w io.Writer, width, height int, level png.CompressionLevel) (*grayPNGWriter, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("png: invalid size %dx%d", width, height)
+	}
+	p := &grayPNGWriter{w: w, width: width, height: height}
+	if _, err := io.WriteString(w, "\x89PNG\r\n\x1a\n"); err != nil {
+		return nil, err
+	}
+	var ihdr [13]byte
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(width))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(height))
+	ihdr[8] = 8 // bit depth
+	ihdr[9] = 0 // grayscale
+	if err := writePNGChunk(w, "IHDR", ihdr[:]); err != nil {
+		return nil, err
+	}
+	p.idat.w = w
+	zw, err := zlib.NewWriterLevel(&p.idat, pngZlibLevel(level))
+	if err != nil {
+		return nil, err
+	}
+	p.zw = zw
+	p.prev = make([]byte, width)
+	p.cur = make([]byte, width)
+	for i := range p.filtered {
+		p.filtered[i] = make([]byte, 1+width)
+		p.filtered[i][0] = byte(i)
+	}
+	return p, nil
+}
+
+// WriteRow appends the next row of width gray pixels.
+func (p *grayPNGWriter) WriteRow(row []byte) error {
+	if p.rows >= p.height {
+		return fmt.Errorf("png: too many rows")
+	}
+	copy(p.cur, row[:p.width])
+	_, err := p.zw.Write(p.filter())
+	p.prev, p.cur = p.cur, p.prev
+	p.rows++
+	return err
+}
+
+// filter picks the PNG row filter with the smallest sum of absolute
+// differences, the same heuristic image/png uses.
+func (p *grayPNGWriter) filter() []byte {
+	cur, prev := p.cur, p.prev
+	none, sub, up, avg, paeth := p.filtered[0][1:], p.filtered[1][1:], p.filtered[2][1:], p.filtered[3][1:], p.filtered[4][1:]
+	copy(none, cur)
+	for i := range cur {
+		var left, upLeft byte
+		if i > 0 {
+			left, upLeft = cur[i-1], prev[i-1]
+		}
+		sub[i] = cur[i] - left
+		up[i] = cur[i] - prev[i]
+		avg[i] = cur[i] - byte((int(left)+int(prev[i]))/2)
+		paeth[i] = cur[i] - paethPredictor(left, prev[i], upLeft)
+	}
+	best, bestSum := 0, -1
+	for f := range p.filtered {
+		sum := 0
+		for _, b := range p.filtered[f][1:] {
+			sum += absInt(int(int8(b)))
+		}
+		if bestSum < 0 || sum < bestSum {
+			best, bestSum = f, sum
+		}
+	}
+	return p.filtered[best]
+}
+
+func paethPredictor(a, b, c byte) byte {
+	pa := absInt(int(b) - int(c))
+	pb := absInt(int(a) - int(c))
+	pc := absInt(int(a) + int(b) - 2*int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	default:
+		return c
+	}
+}
+
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// Close flushes the image data and writes the trailer.
+func (p *grayPNGWriter) Close() error {
+	if p.rows != p.height {
+		return fmt.Errorf("png: wrote %d of %d rows", p.rows, p.height)
+	}
+	if err := p.zw.Close(); err != nil {
+		return err
+	}
+	if err := p.idat.flush(); err != nil {
+		return err
+	}
+	return writePNGChunk(p.w, "IEND", nil)
+}
+
+// chunkWriter buffers compressed data into IDAT chunks of up to 64 KiB.
+type chunkWriter struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+const maxIDATSize = 64 << 10
+
+func (c *chunkWriter) Write(b []byte) (int, error) {
+	c.buf.Write(b)
+	for c.buf.Len() >= maxIDATSize {
+		if err := writePNGChunk(c.w, "IDAT", c.buf.Next(maxIDATSize)); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (c *chunkWriter) flush() error {
+	if c.buf.Len() == 0 {
+		return nil
+	}
+	return writePNGChunk(c.w, "IDAT", c.buf.Next(c.buf.Len()))
+}
+
+func writePNGChunk(w io.Writer, name string, data []byte) error {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(data)))
+	copy(header[4:], name)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	var footer [4]byte
+	binary.BigEndian.PutUint32(footer[:], crc.Sum32())
+	for _, b := range [][]byte{header[:], data, footer[:]} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
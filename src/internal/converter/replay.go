@@ -0,0 +1,152 @@
+package converter
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"math"
+	"time"
+
+	"github.com/merridan/sngo/internal/note"
+	"github.com/merridan/sngo/internal/render"
+)
+
+// ReplayOptions controls stroke replay animations.
+type ReplayOptions struct {
+	Scale           float64       // output scale relative to the device raster (0 = native)
+	FPS             float64       // frames per second
+	StrokesPerFrame int           // strokes added between frames
+	Hold            time.Duration // extra time the finished page stays on screen
+	Background      bool          // draw strokes over the page template
+}
+
+func (o ReplayOptions) normalized() ReplayOptions {
+	if o.Scale <= 0 {
+		o.Scale = 1
+	}
+	if o.FPS <= 0 {
+		o.FPS = 10
+	}
+	if o.StrokesPerFrame <= 0 {
+		o.StrokesPerFrame = 1
+	}
+	return o
+}
+
+// HoldFrames returns how many extra copies of the final frame cover the hold.
+func (o ReplayOptions) HoldFrames() int {
+	o = o.normalized()
+	return int(math.Ceil(o.Hold.Seconds() * o.FPS))
+}
+
+// ReplayPage redraws a page stroke by stroke in drawing order. emit is called
+// first with the empty page and then after every StrokesPerFrame strokes,
+// with the canvas and the rectangle that changed since the previous frame.
+// The canvas is reused between calls and released when ReplayPage returns.
+func ReplayPage(nb *note.Notebook, pageNum int, opts ReplayOptions, emit func(canvas *note.GrayImage, dirty image.Rectangle) error) error {
+	if pageNum < 0 || pageNum >= len(nb.Pages) {
+		return fmt.Errorf("page %d does not exist (total pages: %d)", pageNum, len(nb.Pages))
+	}
+	if nb.Pages[pageNum].Horizontal() {
+		return fmt.Errorf("page %d: stroke replay is not supported for landscape pages", pageNum)
+	}
+	opts = opts.normalized()
+	strokes, err := nb.Strokes(pageNum)
+	if err != nil && err != note.ErrNoStrokes {
+		return err
+	}
+
+	w := int(math.Round(float64(nb.W) * opts.Scale))
+	h := int(math.Round(float64(nb.H) * opts.Scale))
+	canvas, err := replayCanvas(nb, pageNum, w, h, opts.Background)
+	if err != nil {
+		return err
+	}
+	defer canvas.Release()
+
+	if err := emit(canvas, canvas.Bounds()); err != nil {
+		return err
+	}
+	for i := 0; i < len(strokes); i += opts.StrokesPerFrame {
+		batch := strokes[i:min(i+opts.StrokesPerFrame, len(strokes))]
+		dirty := render.Draw(canvas, batch, opts.Scale)
+		if err := emit(canvas, dirty); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replayCanvas returns an opaque w*h page holding the background, or blank paper.
+func replayCanvas(nb *note.Notebook, pageNum, w, h int, withBackground bool) (*note.GrayImage, error) {
+	canvas := note.NewGrayImage(image.Rect(0, 0, w, h), true)
+	if !withBackground {
+		return canvas, nil
+	}
+	bg, err := nb.DecodeBackgroundLayer(pageNum)
+	if err != nil || bg == nil {
+		return canvas, err
+	}
+	if b := bg.Bounds(); b.Dx() != w || b.Dy() != h {
+		scaled := Resample(bg, w, h)
+		bg.Release()
+		bg = scaled
+	}
+	alpha := canvas.Alpha()
+	for i := range alpha {
+		alpha[i] = 0
+	}
+	note.Composite(canvas, bg)
+	bg.Release()
+	return canvas, nil
+}
+
+// grayPalette maps palette index i to gray level i, so gray pixels copy
+// straight into GIF frames.
+var grayPalette = func() color.Palette {
+	p := make(color.Palette, 256)
+	for i := range p {
+		p[i] = color.Gray{Y: uint8(i)}
+	}
+	return p
+}()
+
+// EncodeReplayGIF writes an animated GIF replaying a page. Only the first
+// frame covers the whole page; later frames hold just the area their strokes
+// touched, which keeps long replays small in memory and on disk.
+func EncodeReplayGIF(w io.Writer, nb *note.Notebook, pageNum int, opts ReplayOptions) error {
+	opts = opts.normalized()
+	delay := int(math.Round(100 / opts.FPS))
+	anim := &gif.GIF{}
+	err := ReplayPage(nb, pageNum, opts, func(canvas *note.GrayImage, dirty image.Rectangle) error {
+		if dirty.Empty() {
+			// Keep timing even when a batch drew nothing visible.
+			dirty = image.Rect(0, 0, 1, 1)
+		}
+		anim.Image = append(anim.Image, grayFrame(canvas, dirty))
+		anim.Delay = append(anim.Delay, delay)
+		anim.Disposal = append(anim.Disposal, gif.DisposalNone)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	last := len(anim.Delay) - 1
+	anim.Delay[last] += int(math.Round(opts.Hold.Seconds() * 100))
+	b := anim.Image[0].Bounds()
+	anim.Config = image.Config{ColorModel: grayPalette, Width: b.Dx(), Height: b.Dy()}
+	return gif.EncodeAll(w, anim)
+}
+
+// grayFrame copies r of the canvas into a gray-paletted frame.
+func grayFrame(canvas *note.GrayImage, r image.Rectangle) *image.Paletted {
+	frame := image.NewPaletted(r, grayPalette)
+	src := canvas.Pix()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		i := canvas.PixOffset(r.Min.X, y)
+		copy(frame.Pix[frame.PixOffset(r.Min.X, y):], src[i:i+r.Dx()])
+	}
+	return frame
+}
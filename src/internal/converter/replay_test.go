@@ -0,0 +1,58 @@
+package converter
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"testing"
+	"time"
+
+	"github.com/merridan/sngo/internal/note"
+)
+
+func TestReplayPageEmitsBatches(t *testing.T) {
+	nb := openExample(t)
+	strokes, err := nb.Strokes(0)
+	if err != nil {
+		t.Fatalf("Strokes failed: %v", err)
+	}
+	frames := 0
+	err = ReplayPage(nb, 0, ReplayOptions{StrokesPerFrame: 10}, func(canvas *note.GrayImage, dirty image.Rectangle) error {
+		if frames == 0 && dirty != canvas.Bounds() {
+			t.Errorf("Expected first frame to cover the page, got %v", dirty)
+		}
+		frames++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReplayPage failed: %v", err)
+	}
+	if want := 1 + (len(strokes)+9)/10; frames != want {
+		t.Errorf("Expected %d frames, got %d", want, frames)
+	}
+}
+
+func TestEncodeReplayGIF(t *testing.T) {
+	nb := openExample(t)
+	var buf bytes.Buffer
+	opts := ReplayOptions{FPS: 20, StrokesPerFrame: 8, Hold: 2 * time.Second}
+	if err := EncodeReplayGIF(&buf, nb, 0, opts); err != nil {
+		t.Fatalf("EncodeReplayGIF failed: %v", err)
+	}
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatalf("gif decode failed: %v", err)
+	}
+	if anim.Config.Width != nb.W || anim.Config.Height != nb.H {
+		t.Errorf("Expected %dx%d animation, got %dx%d", nb.W, nb.H, anim.Config.Width, anim.Config.Height)
+	}
+	if len(anim.Image) < 2 {
+		t.Fatalf("Expected several frames, got %d", len(anim.Image))
+	}
+	if got := anim.Delay[len(anim.Delay)-1]; got != 5+200 {
+		t.Errorf("Expected final frame delay 205, got %d", got)
+	}
+	if opts.HoldFrames() != 40 {
+		t.Errorf("Expected 40 hold frames, got %d", opts.HoldFrames())
+	}
+}
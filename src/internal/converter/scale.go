@@ -0,0 +1,294 @@
+package converter
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/merridan/sngo/internal/logging"
+	"github.com/merridan/sngo/internal/note"
+	"github.com/merridan/sngo/internal/render"
+)
+
+// ScaleForDPI returns the factor that maps the device raster to dpi.
+func ScaleForDPI(nb *note.Notebook, dpi int) float64 {
+	return float64(dpi) / float64(nb.DeviceDPI())
+}
+
+// DecodeLayersScaled returns the main and background layers at scale times
+// the device raster. The main layer is re-rendered from the page's strokes
+// with anti-aliasing, over a smooth resample of whatever else the bitmap
+// holds; when strokes are unavailable the whole bitmap is resampled. The background
+// (nil if withBackground is false or the page has none) is always resampled.
+// Marker strokes multiply over the template, so on a page with markers the
+// background is composited into the main layer before they are drawn, and
+// returned as nil.
+func DecodeLayersScaled(nb *note.Notebook, pageNum int, scale float64, withBackground bool) (*note.GrayImage, *note.GrayImage, error) {
+	if pageNum < 0 || pageNum >= len(nb.Pages) {
+		return nil, nil, fmt.Errorf("page %d does not exist (total pages: %d)", pageNum, len(nb.Pages))
+	}
+	if scale <= 0 {
+		return nil, nil, fmt.Errorf("invalid scale %g", scale)
+	}
+
+	mainImg, markers, err := renderMainLayer(nb, pageNum, scale)
+	if err != nil {
+		return nil, nil, err
+	}
+	var bg *note.GrayImage
+	if withBackground {
+		b := mainImg.Bounds()
+		bg = decodeBackgroundScaled(nb, pageNum, b.Dx(), b.Dy())
+	}
+	if len(markers) > 0 {
+		if bg != nil {
+			note.Composite(mainImg, bg)
+			bg.Release()
+			bg = nil
+		}
+		render.Draw(mainImg, markers, scale)
+	}
+	return mainImg, bg, nil
+}
+
+// decodeBackgroundScaled returns the page's background resampled to w*h, or
+// nil if it has none
+func decodeBackgroundScaled(nb *note.Notebook, pageNum, w, h int) *note.GrayImage {
+	bgRaw, err := nb.DecodeBackgroundLayer(pageNum)
+	if err != nil {
+		logging.Warn("background decode failed on page %d: %v", pageNum, err)
+	}
+	if bgRaw == nil {
+		return nil
+	}
+	bg := Resample(bgRaw, w, h)
+	bgRaw.Release()
+	return bg
+}
+
+// renderMainLayer draws the page's strokes, or resamples the bitmap if they are
+// missing. The result is the bitmap's size times scale, so landscape pages
+// stay landscape. Content of the bitmap that is not a stroke (pasted images,
+// text boxes, shapes) is resampled and kept under the strokes. Marker strokes
+// are returned to be drawn over the finished page.
+func renderMainLayer(nb *note.Notebook, pageNum int, scale float64) (*note.GrayImage, []note.Stroke, error) {
+	var strokes []note.Stroke
+	if !nb.Pages[pageNum].Horizontal() {
+		var err error
+		strokes, err = nb.Strokes(pageNum)
+		if err != nil || len(strokes) == 0 {
+			logging.Debug("page %d: no usable strokes (%v), resampling bitmap", pageNum, err)
+			strokes = nil
+		}
+	} else {
+		logging.Info("page %d: strokes on landscape pages are not supported yet, resampling the bitmap instead", pageNum)
+	}
+	bitmap, err := nb.DecodeMainLayer(pageNum)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer bitmap.Release()
+	w := int(math.Round(float64(bitmap.Bounds().Dx()) * scale))
+	h := int(math.Round(float64(bitmap.Bounds().Dy()) * scale))
+	if strokes == nil {
+		return Resample(bitmap, w, h), nil, nil
+	}
+	ink, markers := render.SplitMarkers(strokes)
+	layer := render.Layer(ink, w, h, scale)
+	if n := eraseStrokes(bitmap, strokes); n > 0 {
+		logging.Debug("page %d: keeping %d pixels of non-stroke content", pageNum, n)
+		rest := Resample(bitmap, w, h)
+		overlay(layer, rest)
+		rest.Release()
+	}
+	return layer, markers, nil
+}
+
+// strokeMargin is how far around a modelled stroke, in device pixels, the
+// device's own rendering of it may reach: its pens draw wider than the stroke
+// model in places. Other content closer than this to a stroke is dropped too.
+const strokeMargin = 8
+
+// eraseStrokes makes the pixels of bitmap covered by strokes transparent, so
+// only content drawn some other way is left. It returns how many visible
+// pixels remain.
+func eraseStrokes(bitmap *note.GrayImage, strokes []note.Stroke) int {
+	alpha := bitmap.Alpha()
+	if alpha == nil {
+		return 0
+	}
+	b := bitmap.Bounds()
+	w, h := b.Dx(), b.Dy()
+	mask := render.Layer(strokes, w, h, 1)
+	defer mask.Release()
+
+	// Grow the stroke mask by strokeMargin, first along rows, then along columns
+	grown := make([]bool, w*h)
+	for i, a := range mask.Alpha() {
+		grown[i] = a != 0
+	}
+	grown = spread(grown, w, h, 1, w)
+	grown = spread(grown, h, w, w, 1)
+
+	visible := 0
+	for y := 0; y < h; y++ {
+		i := bitmap.PixOffset(b.Min.X, b.Min.Y+y)
+		for x := 0; x < w; x++ {
+			if grown[y*w+x] {
+				alpha[i+x] = 0
+			} else if alpha[i+x] != 0 {
+				visible++
+			}
+		}
+	}
+	return visible
+}
+
+// spread marks every cell within strokeMargin of a marked one along lines of
+// n cells; cell j of line l is at l*lineStep + j*step.
+func spread(marked []bool, n, lines, step, lineStep int) []bool {
+	out := make([]bool, len(marked))
+	for l := 0; l < lines; l++ {
+		at := func(j int) int { return l*lineStep + j*step }
+		last := -strokeMargin - 1
+		for j := 0; j < n; j++ {
+			if marked[at(j)] {
+				last = j
+			}
+			out[at(j)] = j-last <= strokeMargin
+		}
+		next := n + strokeMargin
+		for j := n - 1; j >= 0; j-- {
+			if marked[at(j)] {
+				next = j
+			}
+			if next-j <= strokeMargin {
+				out[at(j)] = true
+			}
+		}
+	}
+	return out
+}
+
+// overlay puts under beneath top with the non-premultiplied "over" operator,
+// keeping transparency where neither has content. Both must have alpha and
+// the same bounds.
+func overlay(top, under *note.GrayImage) {
+	tp, ta := top.Pix(), top.Alpha()
+	up, ua := under.Pix(), under.Alpha()
+	for i := range tp {
+		if ua[i] == 0 || ta[i] == 255 {
+			continue
+		}
+		at, au := float64(ta[i])/255, float64(ua[i])/255
+		oa := at + au*(1-at)
+		v := (float64(tp[i])*at + float64(up[i])*au*(1-at)) / oa
+		tp[i] = uint8(math.Round(v))
+		ta[i] = uint8(math.Round(oa * 255))
+	}
+}
+
+// Resample scales src to w*h with bilinear filtering. Interpolation is done on
+// alpha-premultiplied values so transparent paper does not bleed into ink edges.
+func Resample(src *note.GrayImage, w, h int) *note.GrayImage {
+	sb := src.Bounds()
+	dst := note.NewGrayImage(image.Rect(0, 0, w, h), src.Alpha() != nil)
+	if sb.Empty() || w == 0 || h == 0 {
+		return dst
+	}
+	spix, salpha := src.Pix(), src.Alpha()
+	dpix, dalpha := dst.Pix(), dst.Alpha()
+	sw, sh := sb.Dx(), sb.Dy()
+	fx := float64(sw) / float64(w)
+	fy := float64(sh) / float64(h)
+
+	sample := func(x, y int) (v, a float64) {
+		i := src.PixOffset(sb.Min.X+x, sb.Min.Y+y)
+		a = 1
+		if salpha != nil {
+			a = float64(salpha[i]) / 255
+		}
+		return float64(spix[i]) * a, a
+	}
+	for y := 0; y < h; y++ {
+		sy := math.Max(0, (float64(y)+0.5)*fy-0.5)
+		y0 := int(sy)
+		y1 := min(y0+1, sh-1)
+		ty := sy - float64(y0)
+		for x := 0; x < w; x++ {
+			sx := math.Max(0, (float64(x)+0.5)*fx-0.5)
+			x0 := int(sx)
+			x1 := min(x0+1, sw-1)
+			tx := sx - float64(x0)
+
+			v00, a00 := sample(x0, y0)
+			v10, a10 := sample(x1, y0)
+			v01, a01 := sample(x0, y1)
+			v11, a11 := sample(x1, y1)
+			v := (v00*(1-tx)+v10*tx)*(1-ty) + (v01*(1-tx)+v11*tx)*ty
+			a := (a00*(1-tx)+a10*tx)*(1-ty) + (a01*(1-tx)+a11*tx)*ty
+
+			i := y*w + x
+			if a > 0 {
+				dpix[i] = uint8(math.Round(math.Min(255, v/a)))
+			} else {
+				dpix[i] = 0xff
+			}
+			if dalpha != nil {
+				dalpha[i] = uint8(math.Round(a * 255))
+			}
+		}
+	}
+	return dst
+}
+
+// ConvertPageToImageAt is ConvertPageToImage at scale times the device raster.
+func ConvertPageToImageAt(nb *note.Notebook, pageNum int, scale float64) (image.Image, error) {
+	if scale == 1 {
+		return ConvertPageToImage(nb, pageNum)
+	}
+	mainImg, bgImg, err := DecodeLayersScaled(nb, pageNum, scale, true)
+	if err != nil {
+		return nil, err
+	}
+	if bgImg != nil {
+		note.Composite(mainImg, bgImg)
+		bgImg.Release()
+	}
+	return mainImg, nil
+}
+
+// Thumbnail shrinks src to width pixels wide, keeping the aspect ratio. Each
+// output pixel averages the source pixels it covers, so thin pen lines fade
+// instead of vanishing as they would with Resample at large reductions.
+func Thumbnail(src *note.GrayImage, width int) *note.GrayImage {
+	sb := src.Bounds()
+	if width <= 0 || width >= sb.Dx() {
+		return Resample(src, sb.Dx(), sb.Dy())
+	}
+	height := max(1, int(math.Round(float64(sb.Dy())*float64(width)/float64(sb.Dx()))))
+	dst := note.NewGrayImage(image.Rect(0, 0, width, height), false)
+	spix, dpix := src.Pix(), dst.Pix()
+	salpha := src.Alpha()
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sb.Dy()/height, max((y+1)*sb.Dy()/height, y*sb.Dy()/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sb.Dx()/width, max((x+1)*sb.Dx()/width, x*sb.Dx()/width+1)
+			sum, n := 0, 0
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(sb.Min.X+x0, sb.Min.Y+sy)
+				for sx := x0; sx < x1; sx, i = sx+1, i+1 {
+					v := int(spix[i])
+					if salpha != nil {
+						// Transparent paper shows as white.
+						v = (v*int(salpha[i]) + 0xff*(255-int(salpha[i]))) / 255
+					}
+					sum += v
+					n++
+				}
+			}
+			dpix[y*width+x] = uint8(sum / n)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,228 @@
+package converter
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"strconv"
+
+	"github.com/merridan/sngo/internal/note"
+)
+
+// Multi-page layouts. A sheet arranges a notebook's pages in a grid of equal
+// cells, one band of cells per grid row: a long scroll is a one-column sheet,
+// a contact sheet has several columns of thumbnails with page labels. Sheets
+// are encoded band by band, so only one row of pages is in memory at a time.
+
+const (
+	sheetBackground = 0xff
+	sheetSeparator  = 0xc9
+	sheetLabelInk   = 0x00
+	labelScale      = 4 // label glyphs are drawn at 4x their 3x5 bitmap
+)
+
+// SheetOptions configures a multi-page layout.
+type SheetOptions struct {
+	Columns   int   // cells per row; 1 stitches pages into one long scroll
+	CellWidth int   // pages are shrunk to this width (0 keeps their size)
+	Gap       int   // space between cells, in pixels
+	Separator int   // thickness of a line drawn across each gap between rows (0 = none)
+	Labels    bool  // print the page number under each cell
+	Numbers   []int // 1-based page number of each cell for labels; nil numbers them 1, 2, ...
+}
+
+// Sheet is the geometry of a laid-out notebook.
+type Sheet struct {
+	opts          SheetOptions
+	pages         int
+	cellW, cellH  int
+	labelH        int
+	width, height int
+}
+
+// NewSheet lays out pages of pageW*pageH pixels.
+func NewSheet(pages, pageW, pageH int, opts SheetOptions) (*Sheet, error) {
+	if pages <= 0 {
+		return nil, fmt.Errorf("layout: no pages")
+	}
+	if opts.Columns <= 0 || opts.Gap < 0 || opts.Separator < 0 || opts.CellWidth < 0 {
+		return nil, fmt.Errorf("layout: invalid options %+v", opts)
+	}
+	if opts.Separator > opts.Gap {
+		return nil, fmt.Errorf("layout: separator (%d) must fit in the gap (%d)", opts.Separator, opts.Gap)
+	}
+	s := &Sheet{opts: opts, pages: pages, cellW: pageW, cellH: pageH}
+	if opts.CellWidth > 0 && opts.CellWidth < pageW {
+		s.cellW = opts.CellWidth
+		s.cellH = max(1, pageH*opts.CellWidth/pageW)
+	}
+	if opts.Labels {
+		s.labelH = (glyphH + 4) * labelScale
+	}
+	cols := min(opts.Columns, pages)
+	rows := (pages + opts.Columns - 1) / opts.Columns
+	s.width = cols*s.cellW + (cols-1)*opts.Gap
+	s.height = rows*(s.cellH+s.labelH) + (rows-1)*opts.Gap
+	return s, nil
+}
+
+// Bounds returns the size of the full sheet.
+func (s *Sheet) Bounds() image.Rectangle { return image.Rect(0, 0, s.width, s.height) }
+
+// EncodePNG streams the sheet as a grayscale PNG. band is called once per
+// grid row with the index of its first page and the number of pages in it,
+// and returns those pages rendered; pages larger than a cell are shrunk.
+// Page buffers are released once the band has been drawn.
+func (s *Sheet) EncodePNG(w io.Writer, level png.CompressionLevel, band func(first, n int) ([]image.Image, error)) error {
+	pw, err := newGrayPNGWriter(w, s.width, s.height, level)
+	if err != nil {
+		return err
+	}
+	cols := s.opts.Columns
+	rowH := s.cellH + s.labelH
+	buf := note.NewGrayImage(image.Rect(0, 0, s.width, rowH), false)
+	defer buf.Release()
+	gapRow := make([]byte, s.width)
+	sepRow := make([]byte, s.width)
+	for i := range gapRow {
+		gapRow[i], sepRow[i] = sheetBackground, sheetSeparator
+	}
+
+	for first := 0; first < s.pages; first += cols {
+		if first > 0 {
+			sepStart := (s.opts.Gap - s.opts.Separator) / 2
+			for y := 0; y < s.opts.Gap; y++ {
+				row := gapRow
+				if y >= sepStart && y < sepStart+s.opts.Separator {
+					row = sepRow
+				}
+				if err := pw.WriteRow(row); err != nil {
+					return err
+				}
+			}
+		}
+		n := min(cols, s.pages-first)
+		imgs, err := band(first, n)
+		if err != nil {
+			return err
+		}
+		s.drawBand(buf, first, imgs)
+		for _, img := range imgs {
+			if g, ok := img.(*note.GrayImage); ok {
+				g.Release()
+			}
+		}
+		for y := 0; y < rowH; y++ {
+			i := buf.PixOffset(0, y)
+			if err := pw.WriteRow(buf.Pix()[i : i+s.width]); err != nil {
+				return err
+			}
+		}
+	}
+	return pw.Close()
+}
+
+// drawBand clears buf and draws one grid row of pages (and labels) into it.
+func (s *Sheet) drawBand(buf *note.GrayImage, first int, imgs []image.Image) {
+	pix := buf.Pix()
+	for i := range pix {
+		pix[i] = sheetBackground
+	}
+	for c, img := range imgs {
+		x := c * (s.cellW + s.opts.Gap)
+		g, ok := img.(*note.GrayImage)
+		if !ok {
+			g = toGrayImage(img)
+			defer g.Release()
+		}
+		if b := g.Bounds(); b.Dx() != s.cellW || b.Dy() != s.cellH {
+			g = Thumbnail(g, s.cellW)
+			defer g.Release()
+		}
+		drawGrayCell(buf, g, x, 0)
+		if s.opts.Labels {
+			number := first + c + 1
+			if s.opts.Numbers != nil {
+				number = s.opts.Numbers[first+c]
+			}
+			label := strconv.Itoa(number)
+			lw := len(label)*(glyphW+1)*labelScale - labelScale
+			drawLabel(buf, label, x+(s.cellW-lw)/2, s.cellH+2*labelScale)
+		}
+	}
+}
+
+// toGrayImage copies any image into a GrayImage with alpha, so pages from
+// other decoders can be laid out too.
+func toGrayImage(img image.Image) *note.GrayImage {
+	b := img.Bounds()
+	g := note.NewGrayImage(image.Rect(0, 0, b.Dx(), b.Dy()), true)
+	draw.Draw(g, g.Bounds(), img, b.Min, draw.Src)
+	return g
+}
+
+// drawGrayCell copies src to (x, y) of dst, flattening transparency onto white.
+func drawGrayCell(dst, src *note.GrayImage, x, y int) {
+	sb := src.Bounds()
+	spix, salpha, dpix := src.Pix(), src.Alpha(), dst.Pix()
+	w := min(sb.Dx(), dst.Bounds().Dx()-x)
+	for row := 0; row < sb.Dy() && y+row < dst.Bounds().Dy(); row++ {
+		si := src.PixOffset(sb.Min.X, sb.Min.Y+row)
+		di := dst.PixOffset(x, y+row)
+		if salpha == nil {
+			copy(dpix[di:di+w], spix[si:si+w])
+			continue
+		}
+		for i := 0; i < w; i++ {
+			a := int(salpha[si+i])
+			dpix[di+i] = uint8((int(spix[si+i])*a + sheetBackground*(255-a) + 127) / 255)
+		}
+	}
+}
+
+// A tiny 3x5 bitmap font for page numbers, one row per string, so labels
+// need no font files.
+const glyphW, glyphH = 3, 5
+
+var digitGlyphs = [10][glyphH]string{
+	{"###", "#.#", "#.#", "#.#", "###"},
+	{".#.", "##.", ".#.", ".#.", "###"},
+	{"###", "..#", "###", "#..", "###"},
+	{"###", "..#", "###", "..#", "###"},
+	{"#.#", "#.#", "###", "..#", "..#"},
+	{"###", "#..", "###", "..#", "###"},
+	{"###", "#..", "###", "#.#", "###"},
+	{"###", "..#", ".#.", ".#.", ".#."},
+	{"###", "#.#", "###", "#.#", "###"},
+	{"###", "#.#", "###", "..#", "###"},
+}
+
+// drawLabel draws a string of digits with its top-left corner at (x, y).
+func drawLabel(dst *note.GrayImage, s string, x, y int) {
+	b := dst.Bounds()
+	pix := dst.Pix()
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			x += (glyphW + 1) * labelScale
+			continue
+		}
+		for gy, line := range digitGlyphs[r-'0'] {
+			for gx, c := range line {
+				if c != '#' {
+					continue
+				}
+				for dy := 0; dy < labelScale; dy++ {
+					for dx := 0; dx < labelScale; dx++ {
+						p := image.Pt(x+gx*labelScale+dx, y+gy*labelScale+dy)
+						if p.In(b) {
+							pix[dst.PixOffset(p.X, p.Y)] = sheetLabelInk
+						}
+					}
+				}
+			}
+		}
+		x += (glyphW + 1) * labelScale
+	}
+}
@@ -0,0 +1,142 @@
+package converter
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/merridan/sngo/internal/note"
+)
+
+func solidPage(w, h int, v uint8) *note.GrayImage {
+	g := note.NewGrayImage(image.Rect(0, 0, w, h), false)
+	for i := range g.Pix() {
+		g.Pix()[i] = v
+	}
+	return g
+}
+
+func grayAt(img image.Image, x, y int) uint8 {
+	return color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+}
+
+func TestSheetEncodePNGGrid(t *testing.T) {
+	sheet, err := NewSheet(5, 40, 60, SheetOptions{Columns: 2, CellWidth: 20, Gap: 10, Separator: 2, Labels: true})
+	if err != nil {
+		t.Fatalf("NewSheet failed: %v", err)
+	}
+	var bands [][2]int
+	var buf bytes.Buffer
+	err = sheet.EncodePNG(&buf, png.BestSpeed, func(first, n int) ([]image.Image, error) {
+		bands = append(bands, [2]int{first, n})
+		imgs := make([]image.Image, n)
+		for i := range imgs {
+			imgs[i] = solidPage(40, 60, 0x40)
+		}
+		return imgs, nil
+	})
+	if err != nil {
+		t.Fatalf("EncodePNG failed: %v", err)
+	}
+	if len(bands) != 3 || bands[2] != [2]int{4, 1} {
+		t.Errorf("Expected three bands ending with page 4 alone, got %v", bands)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("png decode failed: %v", err)
+	}
+	if img.Bounds() != sheet.Bounds() {
+		t.Fatalf("Expected bounds %v, got %v", sheet.Bounds(), img.Bounds())
+	}
+	rowH := 30 + sheet.labelH
+	if got := grayAt(img, 5, 5); got != 0x40 {
+		t.Errorf("Expected page pixel 0x40, got %#x", got)
+	}
+	if got := grayAt(img, 25, 5); got != sheetBackground {
+		t.Errorf("Expected column gap background, got %#x", got)
+	}
+	if got := grayAt(img, 5, rowH+3); got != sheetBackground {
+		t.Errorf("Expected row gap background, got %#x", got)
+	}
+	if got := grayAt(img, 5, rowH+4); got != sheetSeparator {
+		t.Errorf("Expected separator line, got %#x", got)
+	}
+	dark := false
+	for y := 30; y < rowH; y++ {
+		for x := 0; x < 20; x++ {
+			if grayAt(img, x, y) == sheetLabelInk {
+				dark = true
+			}
+		}
+	}
+	if !dark {
+		t.Errorf("Expected a page label under the first cell")
+	}
+}
+
+func TestGrayPNGWriterRoundTrip(t *testing.T) {
+	const w, h = 37, 23
+	var buf bytes.Buffer
+	pw, err := newGrayPNGWriter(&buf, w, h, png.DefaultCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := make([]byte, w)
+	for y := 0; y < h; y++ {
+		for x := range row {
+			row[x] = uint8(x*7 + y*y*3)
+		}
+		if err := pw.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("png decode failed: %v", err)
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if got, want := grayAt(img, x, y), uint8(x*7+y*y*3); got != want {
+				t.Fatalf("pixel (%d,%d) = %d, want %d", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestSheetEncodePNGScrollOtherImages(t *testing.T) {
+	sheet, err := NewSheet(2, 10, 5, SheetOptions{Columns: 1, Gap: 4, Separator: 2})
+	if err != nil {
+		t.Fatalf("NewSheet failed: %v", err)
+	}
+	// Pages that are not GrayImages, one of them transparent where it is not inked
+	rgba := image.NewNRGBA(image.Rect(0, 0, 10, 5))
+	for i := range rgba.Pix {
+		rgba.Pix[i] = 0x80
+	}
+	gray := image.NewGray(image.Rect(0, 0, 10, 5))
+	var buf bytes.Buffer
+	err = sheet.EncodePNG(&buf, png.BestSpeed, func(first, n int) ([]image.Image, error) {
+		return []image.Image{[]image.Image{gray, rgba}[first]}, nil
+	})
+	if err != nil {
+		t.Fatalf("EncodePNG failed: %v", err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("png decode failed: %v", err)
+	}
+	if got := img.Bounds(); got != image.Rect(0, 0, 10, 14) {
+		t.Fatalf("Expected 10x14, got %v", got)
+	}
+	// Half-transparent gray 0x80 over the white sheet
+	for y, want := range map[int]uint8{0: 0x00, 5: sheetBackground, 6: sheetSeparator, 9: 0xbf} {
+		if got := grayAt(img, 0, y); got != want {
+			t.Errorf("row %d: got %#x, want %#x", y, got, want)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package converter
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/merridan/sngo/internal/note"
+)
+
+// Multi-page TIFF output. Each page becomes its own image file directory
+// (IFD) holding 8-bit grayscale, plus an unassociated alpha sample when the
+// page keeps transparency. Strips are Deflate-compressed (lossless, Adobe
+// code 8), which every mainstream TIFF reader accepts.
+
+const (
+	tiffRowsPerStrip = 64
+
+	tiffShort    = 3
+	tiffLong     = 4
+	tiffRational = 5
+
+	tiffCompressionDeflate      = 8
+	tiffPhotometricMinIsBlack   = 1
+	tiffResolutionUnitInch      = 2
+	tiffExtraSampleUnassocAlpha = 2
+)
+
+// TIFFPage is a page compressed and ready to be written by WriteTIFF.
+type TIFFPage struct {
+	width, height int
+	alpha         bool
+	dpi           int
+	strips        [][]byte
+}
+
+// CompressTIFFPage compresses img for a TIFF written at dpi. Pages can be
+// compressed concurrently and written in order afterwards.
+func CompressTIFFPage(img image.Image, dpi int) (*TIFFPage, error) {
+	g, ok := img.(*note.GrayImage)
+	if !ok {
+		return nil, fmt.Errorf("tiff: unsupported image type %T", img)
+	}
+	b := g.Bounds()
+	p := &TIFFPage{width: b.Dx(), height: b.Dy(), alpha: g.Alpha() != nil && !g.Opaque(), dpi: dpi}
+	spp := 1
+	if p.alpha {
+		spp = 2
+	}
+	pix, alpha := g.Pix(), g.Alpha()
+	row := make([]byte, spp*p.width)
+	for y0 := 0; y0 < p.height; y0 += tiffRowsPerStrip {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		for y := y0; y < min(y0+tiffRowsPerStrip, p.height); y++ {
+			i := g.PixOffset(b.Min.X, b.Min.Y+y)
+			if p.alpha {
+				for x := 0; x < p.width; x++ {
+					row[2*x], row[2*x+1] = pix[i+x], alpha[i+x]
+				}
+			} else {
+				copy(row, pix[i:i+p.width])
+			}
+			if _, err := zw.Write(row); err != nil {
+				return nil, err
+			}
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		p.strips = append(p.strips, buf.Bytes())
+	}
+	return p, nil
+}
+
+type tiffEntry struct {
+	tag, typ uint16
+	values   []uint32 // SHORT/LONG values, or numerator/denominator pairs for RATIONAL
+}
+
+func (e tiffEntry) count() uint32 {
+	if e.typ == tiffRational {
+		return uint32(len(e.values) / 2)
+	}
+	return uint32(len(e.values))
+}
+
+func (e tiffEntry) size() uint32 {
+	switch e.typ {
+	case tiffShort:
+		return 2 * uint32(len(e.values))
+	default:
+		return 4 * uint32(len(e.values))
+	}
+}
+
+// WriteTIFF writes pages as a little-endian multi-page TIFF.
+func WriteTIFF(w io.Writer, pages []*TIFFPage) error {
+	if len(pages) == 0 {
+		return fmt.Errorf("tiff: no pages")
+	}
+	cw := &countingWriter{w: w}
+	header := []byte{'I', 'I', 42, 0, 8, 0, 0, 0}
+	if _, err := cw.Write(header); err != nil {
+		return err
+	}
+	for i, p := range pages {
+		if err := writeTIFFPage(cw, p, i, len(pages)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTIFFPage writes one IFD at the current (even) offset, followed by its
+// out-of-line values and strip data. The next-IFD pointer is known up front
+// because the strips are already compressed.
+func writeTIFFPage(cw *countingWriter, p *TIFFPage, index, total int) error {
+	le := binary.LittleEndian
+	spp := uint32(1)
+	bits := []uint32{8}
+	if p.alpha {
+		spp, bits = 2, []uint32{8, 8}
+	}
+	offsets := make([]uint32, len(p.strips))
+	counts := make([]uint32, len(p.strips))
+	for i, s := range p.strips {
+		counts[i] = uint32(len(s))
+	}
+	dpi := uint32(p.dpi)
+	entries := []tiffEntry{
+		{256, tiffLong, []uint32{uint32(p.width)}},
+		{257, tiffLong, []uint32{uint32(p.height)}},
+		{258, tiffShort, bits},
+		{259, tiffShort, []uint32{tiffCompressionDeflate}},
+		{262, tiffShort, []uint32{tiffPhotometricMinIsBlack}},
+		{273, tiffLong, offsets},
+		{277, tiffShort, []uint32{spp}},
+		{278, tiffLong, []uint32{tiffRowsPerStrip}},
+		{279, tiffLong, counts},
+		{282, tiffRational, []uint32{dpi, 1}},
+		{283, tiffRational, []uint32{dpi, 1}},
+		{284, tiffShort, []uint32{1}}, // chunky
+		{296, tiffShort, []uint32{tiffResolutionUnitInch}},
+		{297, tiffShort, []uint32{uint32(index), uint32(total)}}, // PageNumber
+	}
+	if p.alpha {
+		entries = append(entries, tiffEntry{338, tiffShort, []uint32{tiffExtraSampleUnassocAlpha}})
+	}
+
+	// Lay out: IFD, then out-of-line values, then strips.
+	start := uint32(cw.n)
+	ifdSize := 2 + 12*uint32(len(entries)) + 4
+	extra := start + ifdSize
+	valueOffsets := make([]uint32, len(entries))
+	for i, e := range entries {
+		if e.size() > 4 {
+			valueOffsets[i] = extra
+			extra += e.size()
+		}
+	}
+	pos := extra
+	for i, s := range p.strips {
+		offsets[i] = pos
+		pos += uint32(len(s))
+	}
+	next := uint32(0)
+	if index < total-1 {
+		next = pos + pos%2 // IFDs start on a word boundary
+	}
+
+	ifd := make([]byte, 0, ifdSize)
+	ifd = le.AppendUint16(ifd, uint16(len(entries)))
+	var values []byte
+	for i, e := range entries {
+		ifd = le.AppendUint16(ifd, e.tag)
+		ifd = le.AppendUint16(ifd, e.typ)
+		ifd = le.AppendUint32(ifd, e.count())
+		data := e.encode()
+		if valueOffsets[i] != 0 {
+			ifd = le.AppendUint32(ifd, valueOffsets[i])
+			values = append(values, data...)
+		} else {
+			var inline [4]byte
+			copy(inline[:], data)
+			ifd = append(ifd, inline[:]...)
+		}
+	}
+	ifd = le.AppendUint32(ifd, next)
+
+	if _, err := cw.Write(ifd); err != nil {
+		return err
+	}
+	if _, err := cw.Write(values); err != nil {
+		return err
+	}
+	for _, s := range p.strips {
+		if _, err := cw.Write(s); err != nil {
+			return err
+		}
+	}
+	if next != 0 && pos%2 == 1 {
+		_, err := cw.Write([]byte{0})
+		return err
+	}
+	return nil
+}
+
+func (e tiffEntry) encode() []byte {
+	le := binary.LittleEndian
+	out := make([]byte, 0, e.size())
+	for _, v := range e.values {
+		if e.typ == tiffShort {
+			out = le.AppendUint16(out, uint16(v))
+		} else {
+			out = le.AppendUint32(out, v)
+		}
+	}
+	return out
+}
+
+// countingWriter tracks the file offset while writing sequentially.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
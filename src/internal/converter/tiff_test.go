@@ -0,0 +1,115 @@
+package converter
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"io"
+	"testing"
+
+	"github.com/merridan/sngo/internal/note"
+)
+
+// readTIFF walks the IFD chain and returns each page's tags and decompressed pixels.
+func readTIFF(t *testing.T, data []byte) (tags []map[uint16][]uint32, pix [][]byte) {
+	t.Helper()
+	le := binary.LittleEndian
+	if string(data[:4]) != "II*\x00" {
+		t.Fatalf("bad TIFF header % x", data[:4])
+	}
+	for off := le.Uint32(data[4:]); off != 0; {
+		if off%2 != 0 {
+			t.Fatalf("IFD at odd offset %d", off)
+		}
+		n := int(le.Uint16(data[off:]))
+		page := map[uint16][]uint32{}
+		for i := 0; i < n; i++ {
+			e := data[int(off)+2+12*i:]
+			tag, typ, count := le.Uint16(e), le.Uint16(e[2:]), le.Uint32(e[4:])
+			size := map[uint16]uint32{tiffShort: 2, tiffLong: 4, tiffRational: 8}[typ] * count
+			v := e[8:12]
+			if size > 4 {
+				v = data[le.Uint32(e[8:]):]
+			}
+			var vals []uint32
+			for j := uint32(0); j < count; j++ {
+				switch typ {
+				case tiffShort:
+					vals = append(vals, uint32(le.Uint16(v[2*j:])))
+				case tiffLong:
+					vals = append(vals, le.Uint32(v[4*j:]))
+				case tiffRational:
+					vals = append(vals, le.Uint32(v[8*j:]), le.Uint32(v[8*j+4:]))
+				}
+			}
+			page[tag] = vals
+		}
+		var raw []byte
+		for i, so := range page[273] {
+			zr, err := zlib.NewReader(bytes.NewReader(data[so : so+page[279][i]]))
+			if err != nil {
+				t.Fatalf("strip %d: %v", i, err)
+			}
+			b, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("strip %d: %v", i, err)
+			}
+			raw = append(raw, b...)
+		}
+		tags = append(tags, page)
+		pix = append(pix, raw)
+		off = le.Uint32(data[int(off)+2+12*n:])
+	}
+	return tags, pix
+}
+
+func TestWriteTIFFMultiPage(t *testing.T) {
+	nb := openExample(t)
+	img, err := ConvertPageToImage(nb, 0)
+	if err != nil {
+		t.Fatalf("ConvertPageToImage failed: %v", err)
+	}
+	page := img.(*note.GrayImage)
+	defer page.Release()
+
+	ink := note.NewGrayImage(image.Rect(0, 0, 3, 100), true)
+	defer ink.Release()
+	ink.Alpha()[0] = 0
+
+	var pages []*TIFFPage
+	for _, g := range []*note.GrayImage{page, ink} {
+		p, err := CompressTIFFPage(g, 300)
+		if err != nil {
+			t.Fatalf("CompressTIFFPage failed: %v", err)
+		}
+		pages = append(pages, p)
+	}
+	var buf bytes.Buffer
+	if err := WriteTIFF(&buf, pages); err != nil {
+		t.Fatalf("WriteTIFF failed: %v", err)
+	}
+
+	tags, pix := readTIFF(t, buf.Bytes())
+	if len(tags) != 2 {
+		t.Fatalf("Expected 2 IFDs, got %d", len(tags))
+	}
+	if w, h := tags[0][256][0], tags[0][257][0]; int(w) != nb.W || int(h) != nb.H {
+		t.Errorf("Expected %dx%d, got %dx%d", nb.W, nb.H, w, h)
+	}
+	if r := tags[0][282]; r[0] != 300 || r[1] != 1 || tags[0][296][0] != tiffResolutionUnitInch {
+		t.Errorf("Expected 300 dpi resolution tags, got %v unit %v", r, tags[0][296])
+	}
+	if !bytes.Equal(pix[0], page.Pix()) {
+		t.Errorf("First page pixels do not round-trip")
+	}
+	if tags[1][277][0] != 2 || tags[1][338][0] != tiffExtraSampleUnassocAlpha {
+		t.Errorf("Expected gray+alpha second page, got spp %v extra %v", tags[1][277], tags[1][338])
+	}
+	if len(pix[1]) != 2*3*100 || pix[1][1] != 0 || pix[1][3] != 0xff {
+		t.Errorf("Unexpected gray+alpha samples % x", pix[1][:4])
+	}
+	if got := tags[1][297]; got[0] != 1 || got[1] != 2 {
+		t.Errorf("Expected PageNumber 1 of 2, got %v", got)
+	}
+}
@@ -2,11 +2,16 @@ package logging
 
 import (
 	"fmt"
+	"io"
 	"log"
+	"os"
 )
 
 var currentLogLevel string = "info"
 
+// infoOutput receives info messages; the other levels go through package log
+var infoOutput io.Writer = os.Stdout
+
 // Log level constants
 const (
 	LevelDebug = "debug"
@@ -20,6 +25,12 @@ func SetLevel(level string) {
 	currentLogLevel = level
 }
 
+// SetInfoOutput redirects info messages, e.g. to standard error when
+// standard output carries data
+func SetInfoOutput(w io.Writer) {
+	infoOutput = w
+}
+
 // Debug logs a debug message
 func Debug(format string, args ...interface{}) {
 	if shouldLog(LevelDebug) {
@@ -30,7 +41,7 @@ func Debug(format string, args ...interface{}) {
 // Info logs an info message
 func Info(format string, args ...interface{}) {
 	if shouldLog(LevelInfo) {
-		fmt.Printf(format+"\n", args...)
+		fmt.Fprintf(infoOutput, format+"\n", args...)
 	}
 }
 
@@ -1,6 +1,8 @@
 package logging
 
 import (
+	"bytes"
+	"os"
 	"testing"
 )
 
@@ -10,3 +12,14 @@ func TestSetLevel(t *testing.T) {
 		SetLevel(lvl)
 	}
 }
+
+func TestSetInfoOutput(t *testing.T) {
+	var buf bytes.Buffer
+	SetLevel("info")
+	SetInfoOutput(&buf)
+	defer SetInfoOutput(os.Stdout)
+	Info("wrote %d pages", 3)
+	if buf.String() != "wrote 3 pages\n" {
+		t.Errorf("Expected info message in the writer, got %q", buf.String())
+	}
+}
@@ -0,0 +1,263 @@
+package note
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Titles, keywords and links live in the footer as one entry per item. Keys
+// carry the 1-based page number in four digits after the prefix followed by
+// the item's vertical position, e.g. TITLE_00020000000340; the value is the
+// address of the item's metadata block.
+const (
+	footerTitlePrefix   = "TITLE_"
+	footerKeywordPrefix = "KEYWORD_"
+	footerLinkPrefix    = "LINKO_" // outgoing links; LINKI_ holds the incoming side
+)
+
+// Title is a heading the user marked on a page.
+type Title struct {
+	Page  int             // 0-based page index
+	Level int             // 1 (largest) .. 4
+	Rect  image.Rectangle // area of the page the title covers
+}
+
+// Keyword is a tag the user attached to a page.
+type Keyword struct {
+	Page int
+	Text string
+}
+
+// LinkType says what a link points at.
+type LinkType int
+
+const (
+	LinkToPage LinkType = 0 // a page of a note (possibly this one)
+	LinkToFile LinkType = 1 // another file on the device
+	LinkToWeb  LinkType = 4
+)
+
+// Link is an outgoing link drawn on a page.
+type Link struct {
+	Page       int
+	Type       LinkType
+	Rect       image.Rectangle
+	Target     string // device path of the target file, or the URL for web links
+	TargetFile FileID // FILE_ID of the target note, if known
+	TargetPage PageID // PAGEID of the target page, if the link points at a page
+}
+
+// Titles returns the notebook's titles ordered by page and position.
+func (nb *Notebook) Titles() ([]Title, error) {
+	var titles []Title
+	err := nb.eachFooterItem(footerTitlePrefix, func(page int, meta map[string]string) error {
+		level, _ := strconv.Atoi(meta["TITLELEVEL"])
+		titles = append(titles, Title{Page: page, Level: max(level, 1), Rect: parseRect(meta["TITLERECTORI"], meta["TITLERECT"])})
+		return nil
+	})
+	return titles, err
+}
+
+// Keywords returns the notebook's keywords ordered by page and position.
+func (nb *Notebook) Keywords() ([]Keyword, error) {
+	var keywords []Keyword
+	err := nb.eachFooterItem(footerKeywordPrefix, func(page int, meta map[string]string) error {
+		if p, err := strconv.Atoi(meta["KEYWORDPAGE"]); err == nil && p > 0 {
+			page = p - 1
+		}
+		// KEYWORDSITE points at a block holding the keyword's text.
+		addr, _ := strconv.ParseInt(meta["KEYWORDSITE"], 10, 64)
+		if addr == 0 {
+			return nil
+		}
+		text, err := readBlock(nb.src, addr)
+		if err != nil {
+			return fmt.Errorf("keyword text: %w", err)
+		}
+		if kw := strings.TrimSpace(string(text)); kw != "" {
+			keywords = append(keywords, Keyword{Page: page, Text: kw})
+		}
+		return nil
+	})
+	return keywords, err
+}
+
+// Links returns the notebook's outgoing links ordered by page and position.
+func (nb *Notebook) Links() ([]Link, error) {
+	var links []Link
+	err := nb.eachFooterItem(footerLinkPrefix, func(page int, meta map[string]string) error {
+		typ, _ := strconv.Atoi(meta["LINKTYPE"])
+		l := Link{
+			Page:       page,
+			Type:       LinkType(typ),
+			Rect:       parseRect(meta["LINKRECTORI"], meta["LINKRECT"]),
+			TargetFile: FileID(meta["LINKFILEID"]),
+			TargetPage: PageID(meta["PAGEID"]),
+		}
+		// The target path is stored base64 encoded.
+		if target, err := base64.StdEncoding.DecodeString(meta["LINKFILE"]); err == nil {
+			l.Target = string(target)
+		}
+		if l.TargetFile == "none" {
+			l.TargetFile = ""
+		}
+		if l.TargetPage == "none" {
+			l.TargetPage = ""
+		}
+		links = append(links, l)
+		return nil
+	})
+	return links, err
+}
+
+// PageIndex returns the index of the page with the given PAGEID, or -1.
+func (nb *Notebook) PageIndex(id PageID) int {
+	for i, pm := range nb.Pages {
+		if pm.ID() == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// eachFooterItem visits footer entries with prefix in page/position order,
+// reading each entry's metadata block.
+func (nb *Notebook) eachFooterItem(prefix string, fn func(page int, meta map[string]string) error) error {
+	var keys []string
+	for k := range nb.Footer {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		suffix := k[len(prefix):]
+		if len(suffix) < 4 {
+			continue
+		}
+		page, err := strconv.Atoi(suffix[:4])
+		if err != nil {
+			continue
+		}
+		meta, err := readMeta(nb.src, toInt64(nb.Footer[k]))
+		if err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		if err := fn(page-1, meta); err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+	}
+	return nil
+}
+
+// parseRect reads an "x,y,w,h" rectangle, preferring the first non-empty value.
+func parseRect(values ...string) image.Rectangle {
+	for _, v := range values {
+		parts := strings.Split(v, ",")
+		if len(parts) != 4 {
+			continue
+		}
+		var n [4]int
+		ok := true
+		for i, p := range parts {
+			var err error
+			if n[i], err = strconv.Atoi(strings.TrimSpace(p)); err != nil {
+				ok = false
+			}
+		}
+		if ok {
+			return image.Rect(n[0], n[1], n[0]+n[2], n[1]+n[3])
+		}
+	}
+	return image.Rectangle{}
+}
+
+// RecognizedWord is a word from the device's handwriting recognition.
+type RecognizedWord struct {
+	Text string
+	Rect image.Rectangle // in page pixels; empty for spaces and line breaks
+}
+
+// recognText is the subset of the device's recognition JSON we use.
+type recognText struct {
+	Elements []struct {
+		Type  string `json:"type"`
+		Label string `json:"label"`
+		Words []struct {
+			Label string `json:"label"`
+			Box   *struct {
+				X      float64 `json:"x"`
+				Y      float64 `json:"y"`
+				Width  float64 `json:"width"`
+				Height float64 `json:"height"`
+			} `json:"bounding-box"`
+		} `json:"words"`
+	} `json:"elements"`
+}
+
+// RecognizedText returns the page's recognized text and its words, or an
+// empty string if the device has not recognized the page.
+func (nb *Notebook) RecognizedText(idx int) (string, []RecognizedWord, error) {
+	if idx < 0 || idx >= len(nb.Pages) {
+		return "", nil, fmt.Errorf("page index out of range")
+	}
+	pm := nb.Pages[idx]
+	addr, _ := strconv.ParseInt(pm.Params["RECOGNTEXT"], 10, 64)
+	if addr == 0 {
+		return "", nil, nil
+	}
+	raw, err := readBlock(nb.src, addr)
+	if err != nil {
+		return "", nil, fmt.Errorf("recognized text: %w", err)
+	}
+	// The block is base64 encoded JSON.
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil {
+		return "", nil, fmt.Errorf("recognized text: %w", err)
+	}
+	var rt recognText
+	if err := json.Unmarshal(data, &rt); err != nil {
+		return "", nil, fmt.Errorf("recognized text: %w", err)
+	}
+	// Word boxes are in millimetres.
+	pxPerMM := float64(nb.DeviceDPI()) / 25.4
+	var text []string
+	var words []RecognizedWord
+	for _, el := range rt.Elements {
+		if el.Type != "Text" {
+			continue
+		}
+		text = append(text, el.Label)
+		for _, w := range el.Words {
+			rw := RecognizedWord{Text: w.Label}
+			if w.Box != nil {
+				rw.Rect = image.Rect(
+					int(w.Box.X*pxPerMM), int(w.Box.Y*pxPerMM),
+					int((w.Box.X+w.Box.Width)*pxPerMM), int((w.Box.Y+w.Box.Height)*pxPerMM),
+				)
+			}
+			words = append(words, rw)
+		}
+	}
+	return strings.TrimSpace(strings.Join(text, "\n")), words, nil
+}
+
+// TextIn joins the recognized words whose centre lies inside r.
+func TextIn(words []RecognizedWord, r image.Rectangle) string {
+	var parts []string
+	for _, w := range words {
+		if w.Rect.Empty() || strings.TrimSpace(w.Text) == "" {
+			continue
+		}
+		c := image.Pt((w.Rect.Min.X+w.Rect.Max.X)/2, (w.Rect.Min.Y+w.Rect.Max.Y)/2)
+		if c.In(r) {
+			parts = append(parts, w.Text)
+		}
+	}
+	return strings.Join(parts, " ")
+}
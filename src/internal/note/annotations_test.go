@@ -0,0 +1,118 @@
+package note
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"sort"
+	"testing"
+)
+
+// noteBuilder assembles a minimal synthetic .note file in memory.
+type noteBuilder struct {
+	buf    bytes.Buffer
+	footer map[string]string
+}
+
+func newNoteBuilder() *noteBuilder {
+	b := &noteBuilder{footer: map[string]string{}}
+	b.buf.WriteString("noteSN_FILE_VER_20230015")
+	return b
+}
+
+// block appends a length-prefixed block and returns its address.
+func (b *noteBuilder) block(data []byte) int {
+	addr := b.buf.Len()
+	binary.Write(&b.buf, binary.LittleEndian, uint32(len(data)))
+	b.buf.Write(data)
+	return addr
+}
+
+func (b *noteBuilder) meta(params map[string]string) int {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var s bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&s, "<%s:%s>", k, params[k])
+	}
+	return b.block(s.Bytes())
+}
+
+func (b *noteBuilder) parse(t *testing.T) *Notebook {
+	t.Helper()
+	addr := b.meta(b.footer)
+	binary.Write(&b.buf, binary.LittleEndian, uint32(addr))
+	nb, err := Parse(bytes.NewReader(b.buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	return nb
+}
+
+func TestAnnotations(t *testing.T) {
+	b := newNoteBuilder()
+	b.footer["FILE_FEATURE"] = fmt.Sprint(b.meta(map[string]string{"FILE_ID": "F20240102030405000000abcdefghijklmn", "APPLY_EQUIPMENT": "N6"}))
+	recogn := `{"elements":[{"type":"Text","label":"Meeting notes\nbudget","words":[` +
+		`{"label":"Meeting","bounding-box":{"x":10,"y":10,"width":10,"height":5}},` +
+		`{"label":" "},` +
+		`{"label":"notes","bounding-box":{"x":22,"y":10,"width":8,"height":5}},` +
+		`{"label":"budget","bounding-box":{"x":10,"y":60,"width":10,"height":5}}]}]}`
+	b.footer["PAGE1"] = fmt.Sprint(b.meta(map[string]string{
+		"PAGEID":     "P20240102030405000000abcdefghijklmn",
+		"RECOGNTEXT": fmt.Sprint(b.block([]byte(base64.StdEncoding.EncodeToString([]byte(recogn))))),
+	}))
+	b.footer["PAGE2"] = fmt.Sprint(b.meta(map[string]string{"PAGEID": "P20240102030406000000abcdefghijklmn"}))
+	b.footer["TITLE_00010000000100"] = fmt.Sprint(b.meta(map[string]string{"TITLELEVEL": "2", "TITLERECTORI": "100,100,300,80"}))
+	b.footer["KEYWORD_00020000000200"] = fmt.Sprint(b.meta(map[string]string{"KEYWORDPAGE": "2", "KEYWORDSITE": fmt.Sprint(b.block([]byte("project x")))}))
+	b.footer["LINKO_00010000000300"] = fmt.Sprint(b.meta(map[string]string{
+		"LINKTYPE":   "0",
+		"LINKFILE":   base64.StdEncoding.EncodeToString([]byte("/storage/emulated/0/Note/Other.note")),
+		"LINKFILEID": "F20240101000000000000zzzzzzzzzzzzzz",
+		"PAGEID":     "P20240101000000000000zzzzzzzzzzzzzz",
+		"LINKRECT":   "10,20,30,40",
+	}))
+	nb := b.parse(t)
+
+	titles, err := nb.Titles()
+	if err != nil || len(titles) != 1 {
+		t.Fatalf("Titles: %v %v", titles, err)
+	}
+	if titles[0].Page != 0 || titles[0].Level != 2 || titles[0].Rect != image.Rect(100, 100, 400, 180) {
+		t.Errorf("Unexpected title %+v", titles[0])
+	}
+
+	keywords, err := nb.Keywords()
+	if err != nil || len(keywords) != 1 || keywords[0] != (Keyword{Page: 1, Text: "project x"}) {
+		t.Errorf("Keywords: %+v %v", keywords, err)
+	}
+
+	links, err := nb.Links()
+	if err != nil || len(links) != 1 {
+		t.Fatalf("Links: %v %v", links, err)
+	}
+	if l := links[0]; l.Target != "/storage/emulated/0/Note/Other.note" || l.Type != LinkToPage || l.TargetFile == "" || l.Rect != image.Rect(10, 20, 40, 60) {
+		t.Errorf("Unexpected link %+v", l)
+	}
+
+	text, words, err := nb.RecognizedText(0)
+	if err != nil {
+		t.Fatalf("RecognizedText failed: %v", err)
+	}
+	if text != "Meeting notes\nbudget" || len(words) != 4 {
+		t.Errorf("Unexpected recognized text %q (%d words)", text, len(words))
+	}
+	if got := TextIn(words, titles[0].Rect); got != "Meeting notes" {
+		t.Errorf("Expected title text %q, got %q", "Meeting notes", got)
+	}
+	if text, _, err := nb.RecognizedText(1); text != "" || err != nil {
+		t.Errorf("Expected no text on page 2, got %q %v", text, err)
+	}
+	if nb.PageIndex("P20240102030406000000abcdefghijklmn") != 1 {
+		t.Errorf("PageIndex did not find page 2")
+	}
+}
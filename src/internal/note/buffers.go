@@ -0,0 +1,29 @@
+package note
+
+import "sync"
+
+// pageBufPool recycles w*h byte slices (pixels, alpha, rotation scratch) across
+// pages and workers. A full device page is ~2.6 MB, so reusing them keeps GC
+// pressure flat on long batch runs.
+var pageBufPool sync.Pool
+
+// getPageBuf returns a zero-length slice with capacity of at least n.
+// A pooled slice that is too small goes back for smaller pages.
+func getPageBuf(n int) []byte {
+	if bp, ok := pageBufPool.Get().(*[]byte); ok {
+		if cap(*bp) >= n {
+			return (*bp)[:0]
+		}
+		pageBufPool.Put(bp)
+	}
+	return make([]byte, 0, n)
+}
+
+// putPageBuf hands b back to the pool; b must not be used afterwards.
+func putPageBuf(b []byte) {
+	if cap(b) == 0 {
+		return
+	}
+	b = b[:0]
+	pageBufPool.Put(&b)
+}
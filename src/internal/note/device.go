@@ -0,0 +1,28 @@
+package note
+
+import "strconv"
+
+// equipmentDPI maps APPLY_EQUIPMENT codes to the panel resolution of each model.
+var equipmentDPI = map[string]int{
+	"A5X": 226, // 10.3" 1404x1872
+	"A6X": 300, // 7.8" 1404x1872
+	"N5":  300, // A5 X2 (Manta) 10.7" 1920x2560
+	"N6":  300, // A6 X2 (Nomad) 7.8" 1404x1872
+}
+
+const defaultDeviceDPI = 226
+
+// DeviceDPI returns the raster resolution of the device that wrote the note,
+// preferring the header's DEVICE_DPI and falling back to the equipment model.
+func (nb *Notebook) DeviceDPI() int {
+	if dpi, _ := strconv.Atoi(nb.Header["DEVICE_DPI"]); dpi > 0 {
+		return dpi
+	}
+	if dpi, ok := equipmentDPI[nb.Header["APPLY_EQUIPMENT"]]; ok {
+		return dpi
+	}
+	return defaultDeviceDPI
+}
+
+// Horizontal reports whether the page is in landscape orientation.
+func (pm PageMeta) Horizontal() bool { return pm.Params["ORIENTATION"] == "1090" }
@@ -0,0 +1,235 @@
+package note
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// GrayImage is a decoded page layer: 8-bit luminance plus an optional alpha
+// mask. It implements draw.Image and follows the image.Gray memory layout, so
+// SubImage shares pixels with its parent and ToGray is a zero-copy view.
+type GrayImage struct {
+	pix    []uint8 // grayscale luminance 0=black 255=white
+	alpha  []uint8 // optional per-pixel alpha (0 transparent, 255 opaque); same layout as pix when present
+	Stride int     // distance in bytes between vertically adjacent pixels
+	Rect   image.Rectangle
+	shared bool // pixels belong to another image (SubImage); Release leaves them alone
+}
+
+var _ draw.Image = (*GrayImage)(nil)
+
+// NewGrayImage returns a white, fully opaque image with pooled buffers.
+// When withAlpha is false the image carries no alpha mask.
+func NewGrayImage(r image.Rectangle, withAlpha bool) *GrayImage {
+	n := r.Dx() * r.Dy()
+	pix := getPageBuf(n)[:n]
+	for i := range pix {
+		pix[i] = 0xff
+	}
+	var alpha []uint8
+	if withAlpha {
+		alpha = getPageBuf(n)[:n]
+		for i := range alpha {
+			alpha[i] = 255
+		}
+	}
+	return &GrayImage{pix: pix, alpha: alpha, Stride: r.Dx(), Rect: r}
+}
+
+// newGrayImage wraps decoder output (row-major w*h) without copying.
+func newGrayImage(pix, alpha []uint8, w, h int) *GrayImage {
+	return &GrayImage{pix: pix, alpha: alpha, Stride: w, Rect: image.Rect(0, 0, w, h)}
+}
+
+// ColorModel is color.GrayModel, or color.NRGBAModel when the image has an
+// alpha mask. At then returns color.NRGBA for pixels that are not fully opaque
+// and color.Gray, which NRGBA represents exactly, for the rest.
+func (g *GrayImage) ColorModel() color.Model {
+	if g.alpha != nil {
+		return color.NRGBAModel
+	}
+	return color.GrayModel
+}
+
+func (g *GrayImage) Bounds() image.Rectangle { return g.Rect }
+func (g *GrayImage) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(g.Rect)) {
+		return color.Gray{}
+	}
+	idx := g.PixOffset(x, y)
+	if g.alpha != nil && g.alpha[idx] != 255 {
+		// Return an RGBA with alpha preserved (opaque pixels stay color.Gray, which boxes without allocating)
+		v := g.pix[idx]
+		a := g.alpha[idx]
+		return color.NRGBA{R: v, G: v, B: v, A: a}
+	}
+	return color.Gray{Y: g.pix[idx]}
+}
+
+// PixOffset returns the index of the pixel at (x, y) in Pix and Alpha.
+func (g *GrayImage) PixOffset(x, y int) int {
+	return (y-g.Rect.Min.Y)*g.Stride + (x - g.Rect.Min.X)
+}
+
+// Set stores c at (x, y). With an alpha mask the color is kept
+// non-premultiplied; without one it is flattened like image.Gray does.
+// A fully transparent color that carries no gray of its own (anything but
+// color.NRGBA) only clears alpha and keeps the gray underneath.
+func (g *GrayImage) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(g.Rect)) {
+		return
+	}
+	idx := g.PixOffset(x, y)
+	if g.alpha == nil {
+		g.pix[idx] = color.GrayModel.Convert(c).(color.Gray).Y
+		return
+	}
+	n, ok := c.(color.NRGBA)
+	if !ok {
+		n = color.NRGBAModel.Convert(c).(color.NRGBA)
+	}
+	if ok || n.A != 0 {
+		g.pix[idx] = color.GrayModel.Convert(color.NRGBA{R: n.R, G: n.G, B: n.B, A: 255}).(color.Gray).Y
+	}
+	g.alpha[idx] = n.A
+}
+
+// SubImage returns the part of g visible through r. The result shares pixels
+// with g, so drawing into it draws into g.
+func (g *GrayImage) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(g.Rect)
+	if r.Empty() {
+		return &GrayImage{shared: true}
+	}
+	i := g.PixOffset(r.Min.X, r.Min.Y)
+	sub := &GrayImage{pix: g.pix[i:], Stride: g.Stride, Rect: r, shared: true}
+	if g.alpha != nil {
+		sub.alpha = g.alpha[i:]
+	}
+	return sub
+}
+
+// Opaque reports whether every pixel in the image is fully opaque.
+func (g *GrayImage) Opaque() bool {
+	if g.alpha == nil || g.Rect.Empty() {
+		return true
+	}
+	w := g.Rect.Dx()
+	for y := g.Rect.Min.Y; y < g.Rect.Max.Y; y++ {
+		i := g.PixOffset(g.Rect.Min.X, y)
+		for _, a := range g.alpha[i : i+w] {
+			if a != 255 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Clone returns a deep copy with its own pooled, tightly packed buffers.
+func (g *GrayImage) Clone() *GrayImage {
+	w, h := g.Rect.Dx(), g.Rect.Dy()
+	c := &GrayImage{pix: getPageBuf(w * h)[:w*h], Stride: w, Rect: g.Rect}
+	if g.alpha != nil {
+		c.alpha = getPageBuf(w * h)[:w*h]
+	}
+	for y := 0; y < h; y++ {
+		i := g.PixOffset(g.Rect.Min.X, g.Rect.Min.Y+y)
+		copy(c.pix[y*w:(y+1)*w], g.pix[i:i+w])
+		if g.alpha != nil {
+			copy(c.alpha[y*w:(y+1)*w], g.alpha[i:i+w])
+		}
+	}
+	return c
+}
+
+// ToGray returns an *image.Gray view sharing g's pixels; alpha is dropped.
+func (g *GrayImage) ToGray() *image.Gray {
+	return &image.Gray{Pix: g.pix, Stride: g.Stride, Rect: g.Rect}
+}
+
+// ToNRGBA expands g into an *image.NRGBA, keeping alpha. buf is reused as the
+// backing array when it holds at least 4*w*h bytes; pass nil to allocate.
+func (g *GrayImage) ToNRGBA(buf []byte) *image.NRGBA {
+	w, h := g.Rect.Dx(), g.Rect.Dy()
+	if cap(buf) < 4*w*h {
+		buf = make([]byte, 4*w*h)
+	}
+	buf = buf[:4*w*h]
+	for y := 0; y < h; y++ {
+		i := g.PixOffset(g.Rect.Min.X, g.Rect.Min.Y+y)
+		row := buf[4*y*w : 4*(y+1)*w]
+		for x, v := range g.pix[i : i+w] {
+			a := uint8(255)
+			if g.alpha != nil {
+				a = g.alpha[i+x]
+			}
+			o := row[4*x : 4*x+4 : 4*x+4]
+			o[0], o[1], o[2], o[3] = v, v, v, a
+		}
+	}
+	return &image.NRGBA{Pix: buf, Stride: 4 * w, Rect: g.Rect}
+}
+
+// Pix returns the underlying pixel slice (row stride Stride) for read-only iteration.
+func (g *GrayImage) Pix() []uint8 { return g.pix }
+
+// Alpha returns the alpha slice (may be nil if not present)
+func (g *GrayImage) Alpha() []uint8 { return g.alpha }
+
+// SetPix sets a raw pixel (0-based index) if within bounds.
+func (g *GrayImage) SetPix(i int, v uint8) {
+	if i >= 0 && i < len(g.pix) {
+		g.pix[i] = v
+	}
+}
+
+// Release returns the pixel and alpha buffers to the shared page pool.
+// The image must not be used afterwards. Sub-images never release their parent's buffers.
+func (g *GrayImage) Release() {
+	if g == nil || g.shared {
+		return
+	}
+	putPageBuf(g.pix)
+	putPageBuf(g.alpha)
+	g.pix, g.alpha = nil, nil
+}
+
+// Histogram returns counts for each grayscale value present.
+func (g *GrayImage) Histogram() map[byte]int {
+	m := make(map[byte]int, 64)
+	w := g.Rect.Dx()
+	for y := g.Rect.Min.Y; y < g.Rect.Max.Y; y++ {
+		i := g.PixOffset(g.Rect.Min.X, y)
+		for _, p := range g.pix[i : i+w] {
+			m[p]++
+		}
+	}
+	return m
+}
+
+// UniformRowSample returns indices of up to n rows that are entirely one value (useful for stripe diagnosis).
+func (g *GrayImage) UniformRowSample(n int) []int {
+	if n <= 0 || g.Rect.Empty() {
+		return nil
+	}
+	res := make([]int, 0, n)
+	w := g.Rect.Dx()
+	for r := g.Rect.Min.Y; r < g.Rect.Max.Y && len(res) < n; r++ {
+		i := g.PixOffset(g.Rect.Min.X, r)
+		row := g.pix[i : i+w]
+		first := row[0]
+		uniform := true
+		for i := 1; i < w; i++ {
+			if row[i] != first {
+				uniform = false
+				break
+			}
+		}
+		if uniform {
+			res = append(res, r)
+		}
+	}
+	return res
+}
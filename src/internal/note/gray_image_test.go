@@ -0,0 +1,72 @@
+package note
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestGrayImageDrawAndSubImage(t *testing.T) {
+	g := NewGrayImage(image.Rect(0, 0, 8, 6), true)
+	sub := g.SubImage(image.Rect(2, 2, 5, 4)).(*GrayImage)
+	draw.Draw(sub, sub.Bounds(), image.NewUniform(color.Gray{Y: 0x40}), image.Point{}, draw.Src)
+	if got := g.At(3, 3); got != (color.Gray{Y: 0x40}) {
+		t.Errorf("Expected drawing into SubImage to update parent, got %v", got)
+	}
+	if got := g.At(1, 1); got != (color.Gray{Y: 0xff}) {
+		t.Errorf("Expected pixel outside SubImage untouched, got %v", got)
+	}
+
+	g.Set(0, 0, color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0})
+	if g.Opaque() {
+		t.Errorf("Expected image with a transparent pixel to report !Opaque")
+	}
+	if !sub.Opaque() {
+		t.Errorf("Expected SubImage without transparent pixels to report Opaque")
+	}
+	if n := g.ToNRGBA(nil).NRGBAAt(0, 0); n.A != 0 {
+		t.Errorf("Expected ToNRGBA to keep alpha, got %v", n)
+	}
+
+	c := sub.Clone()
+	c.Set(2, 2, color.Black)
+	if g.At(2, 2) != (color.Gray{Y: 0x40}) {
+		t.Errorf("Expected Clone to own its pixels")
+	}
+	if gray := c.ToGray(); gray.GrayAt(2, 2).Y != 0 || gray.GrayAt(3, 3).Y != 0x40 {
+		t.Errorf("Expected ToGray to view cloned pixels, got %v %v", gray.GrayAt(2, 2), gray.GrayAt(3, 3))
+	}
+	sub.Release()
+	if g.Pix() == nil {
+		t.Errorf("Expected SubImage.Release to leave parent buffers alone")
+	}
+}
+
+func TestGrayImageColorModel(t *testing.T) {
+	g := NewGrayImage(image.Rect(0, 0, 2, 1), true)
+	if g.ColorModel() != color.NRGBAModel {
+		t.Errorf("Expected NRGBAModel for an image with alpha")
+	}
+	if NewGrayImage(image.Rect(0, 0, 2, 1), false).ColorModel() != color.GrayModel {
+		t.Errorf("Expected GrayModel for an image without alpha")
+	}
+
+	g.Set(0, 0, color.Gray{Y: 0x80})
+	g.Set(0, 0, color.Transparent)
+	if got := g.At(0, 0); got != (color.NRGBA{R: 0x80, G: 0x80, B: 0x80, A: 0}) {
+		t.Errorf("Expected a transparent write to keep the gray value, got %v", got)
+	}
+	g.Set(0, 0, color.Gray{Y: 0x80})
+	if got := g.At(0, 0); got != (color.Gray{Y: 0x80}) {
+		t.Errorf("Expected an opaque write to restore the pixel, got %v", got)
+	}
+	// Every pixel At returns is exactly representable in the reported model
+	for _, c := range []color.Color{g.At(0, 0), g.At(1, 0)} {
+		r1, g1, b1, a1 := c.RGBA()
+		r2, g2, b2, a2 := g.ColorModel().Convert(c).RGBA()
+		if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+			t.Errorf("Expected %v to survive conversion to the color model", c)
+		}
+	}
+}
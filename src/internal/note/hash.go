@@ -0,0 +1,54 @@
+package note
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strconv"
+)
+
+// Page content hashes. A page is drawn from its layer bitmaps, its stroke
+// records (for scaled rendering and replays) and a few style parameters;
+// hashing those raw blocks tells whether a page changed without decoding it.
+// Block addresses are left out, since they move whenever an earlier page grows.
+
+// hashLayerKeys are the page parameters pointing at layer metadata, in hashing order
+var hashLayerKeys = []string{"MAINLAYER", "LAYER1", "LAYER2", "LAYER3", "BGLAYER"}
+
+// hashStyleKeys are the page parameters that change how the layers are drawn
+var hashStyleKeys = []string{"PAGESTYLE", "PAGESTYLEMD5", "ORIENTATION", "LAYERINFO", "LAYERSEQ"}
+
+// contentHash returns the hex SHA-256 of what the page's image is made from.
+func contentHash(src io.ReaderAt, pm PageMeta) (string, error) {
+	h := sha256.New()
+	field := func(name string, value []byte) {
+		io.WriteString(h, name)
+		io.WriteString(h, ":"+strconv.Itoa(len(value))+":")
+		h.Write(value)
+	}
+	for _, key := range hashStyleKeys {
+		field(key, []byte(pm.Params[key]))
+	}
+	for _, key := range hashLayerKeys {
+		meta, err := readMeta(src, toInt64(pm.Params[key]))
+		if err != nil {
+			return "", err
+		}
+		field(key, []byte(meta["LAYERPROTOCOL"]))
+		if addr := toInt64(meta["LAYERBITMAP"]); addr != 0 {
+			data, err := readBlock(src, addr)
+			if err != nil {
+				return "", err
+			}
+			field("LAYERBITMAP", data)
+		}
+	}
+	if addr := toInt64(pm.Params["TOTALPATH"]); addr != 0 {
+		data, err := readBlock(src, addr)
+		if err != nil {
+			return "", err
+		}
+		field("TOTALPATH", data)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
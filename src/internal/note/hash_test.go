@@ -0,0 +1,43 @@
+package note
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestPageHash(t *testing.T) {
+	data, err := os.ReadFile("../../../example_notes/example.note")
+	if err != nil {
+		t.Fatalf("failed to read example.note: %v", err)
+	}
+	nb, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	page := nb.Pages[0]
+	if len(page.Hash) != 64 {
+		t.Fatalf("Expected a SHA-256 page hash, got %q", page.Hash)
+	}
+	again, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if again.Pages[0].Hash != page.Hash {
+		t.Errorf("Expected the same hash from the same file")
+	}
+
+	// A different template changes the page without touching its layers
+	params := map[string]string{}
+	for k, v := range page.Params {
+		params[k] = v
+	}
+	params["PAGESTYLE"] = "style_white"
+	restyled, err := contentHash(nb.src, PageMeta{Params: params})
+	if err != nil {
+		t.Fatalf("contentHash failed: %v", err)
+	}
+	if restyled == page.Hash {
+		t.Errorf("Expected the page style to change the hash")
+	}
+}
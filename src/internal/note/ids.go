@@ -0,0 +1,66 @@
+package note
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Stable identifiers written by the device. Both kinds start with a one-letter
+// prefix followed by a 20-digit local timestamp (yyyyMMddHHmmss + 6 sub-second
+// digits) and a random suffix, e.g. F20250829170623189078rESl9eqStBAD.
+// They survive edits, so they are safe to key outputs and caches on.
+
+const idStampLen = 20
+
+// FileID is the notebook identifier stored as FILE_ID in the header.
+type FileID string
+
+// PageID is the page identifier stored as PAGEID in each page's metadata.
+type PageID string
+
+// ParseFileID validates s as a FILE_ID.
+func ParseFileID(s string) (FileID, error) {
+	if _, err := parseIDStamp('F', s); err != nil {
+		return "", err
+	}
+	return FileID(s), nil
+}
+
+// ParsePageID validates s as a PAGEID.
+func ParsePageID(s string) (PageID, error) {
+	if _, err := parseIDStamp('P', s); err != nil {
+		return "", err
+	}
+	return PageID(s), nil
+}
+
+// CreatedAt returns the creation time encoded in the ID (zero if malformed).
+func (id FileID) CreatedAt() time.Time {
+	t, _ := parseIDStamp('F', string(id))
+	return t
+}
+
+// CreatedAt returns the creation time encoded in the ID (zero if malformed).
+func (id PageID) CreatedAt() time.Time {
+	t, _ := parseIDStamp('P', string(id))
+	return t
+}
+
+// parseIDStamp decodes the timestamp that follows the prefix letter. The
+// device records wall-clock time without a zone, so it is read as local time.
+func parseIDStamp(prefix byte, s string) (time.Time, error) {
+	if len(s) < 1+idStampLen || s[0] != prefix {
+		return time.Time{}, fmt.Errorf("invalid %c id %q", prefix, s)
+	}
+	stamp := s[1 : 1+idStampLen]
+	t, err := time.ParseInLocation("20060102150405", stamp[:14], time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %c id %q: %w", prefix, s, err)
+	}
+	micros, err := strconv.Atoi(stamp[14:])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %c id %q: %w", prefix, s, err)
+	}
+	return t.Add(time.Duration(micros) * time.Microsecond), nil
+}
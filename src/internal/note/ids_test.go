@@ -0,0 +1,23 @@
+package note
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIDCreatedAt(t *testing.T) {
+	want := time.Date(2025, 8, 29, 17, 6, 23, 189078000, time.Local)
+	id, err := ParseFileID("F20250829170623189078rESl9eqStBAD")
+	if err != nil {
+		t.Fatalf("ParseFileID failed: %v", err)
+	}
+	if got := id.CreatedAt(); !got.Equal(want) {
+		t.Errorf("Expected CreatedAt %v, got %v", want, got)
+	}
+	if _, err := ParsePageID("F20250829170623189078rESl9eqStBAD"); err == nil {
+		t.Errorf("Expected error for FILE_ID passed as PAGEID")
+	}
+	if got := PageID("P2025").CreatedAt(); !got.IsZero() {
+		t.Errorf("Expected zero time for malformed id, got %v", got)
+	}
+}
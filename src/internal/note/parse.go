@@ -5,8 +5,6 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"image"
-	"image/color"
 	"image/png"
 	"io"
 	"log"
@@ -15,6 +13,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 // Clean minimal parser + RATTA_RLE decoder (prototype)
@@ -31,16 +30,46 @@ type Notebook struct {
 	Signature string
 	W         int
 	H         int
+	Header    map[string]string
 	Footer    map[string]any
 	Pages     []PageMeta
+	FileID    FileID
+
+	src io.ReaderAt // per-notebook source; safe for concurrent page decodes
+}
+
+type PageMeta struct {
+	Params map[string]string
+	// Hash identifies the page's content: pages with the same hash render the
+	// same. It is empty if a block could not be read.
+	Hash string
 }
 
-type PageMeta struct{ Params map[string]string }
+// ID returns the page's stable PAGEID (empty if the page has none).
+func (pm PageMeta) ID() PageID { return PageID(pm.Params["PAGEID"]) }
 
-var fileReader io.ReadSeeker
+// seekReaderAt adapts a ReadSeeker without ReadAt by serializing seek+read pairs.
+type seekReaderAt struct {
+	mu sync.Mutex
+	r  io.ReadSeeker
+}
 
+func (s *seekReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.r.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.ReadFull(s.r, p)
+}
+
+// Parse reads the notebook structure. r must stay open while pages are decoded;
+// if it implements io.ReaderAt (as *os.File does) pages can be decoded concurrently.
 func Parse(r io.ReadSeeker) (*Notebook, error) {
-	fileReader = r
+	src, ok := r.(io.ReaderAt)
+	if !ok {
+		src = &seekReaderAt{r: r}
+	}
 	buf := make([]byte, 64)
 	if _, err := r.Read(buf); err != nil && !errors.Is(err, io.EOF) {
 		return nil, err
@@ -56,7 +85,7 @@ func Parse(r io.ReadSeeker) (*Notebook, error) {
 	if err := binary.Read(r, binary.LittleEndian, &footerAddr); err != nil {
 		return nil, err
 	}
-	footer, err := readMeta(r, int64(footerAddr))
+	footer, err := readMeta(src, int64(footerAddr))
 	if err != nil {
 		return nil, fmt.Errorf("footer: %w", err)
 	}
@@ -69,16 +98,24 @@ func Parse(r io.ReadSeeker) (*Notebook, error) {
 	sort.Slice(pageAddrs, func(i, j int) bool { return pageAddrs[i] < pageAddrs[j] })
 	pages := make([]PageMeta, 0, len(pageAddrs))
 	for _, a := range pageAddrs {
-		pm, e := readMeta(r, a)
+		pm, e := readMeta(src, a)
 		if e != nil {
 			return nil, e
 		}
-		pages = append(pages, PageMeta{Params: pm})
+		page := PageMeta{Params: pm}
+		// Hashing reads the raw blocks without decoding, so it is cheap enough to always do
+		page.Hash, _ = contentHash(src, page)
+		pages = append(pages, page)
 	}
 	fAny := map[string]any{}
 	for k, v := range footer {
 		fAny[k] = v
 	}
+	// FILE_FEATURE in the footer points at the header block holding FILE_ID.
+	header, err := readMeta(src, toInt64(footer["FILE_FEATURE"]))
+	if err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
 	// Determine page dimensions: default standard; allow env override for experimental high-res.
 	sigStr := string(sig)
 	width := pageWidth
@@ -86,7 +123,7 @@ func Parse(r io.ReadSeeker) (*Notebook, error) {
 	if os.Getenv("SUPERNOTE_FORCE_HIRES") == "1" {
 		width, height = 1920, 2560
 	}
-	return &Notebook{Signature: sigStr, W: width, H: height, Footer: fAny, Pages: pages}, nil
+	return &Notebook{Signature: sigStr, W: width, H: height, Header: header, Footer: fAny, Pages: pages, FileID: FileID(header["FILE_ID"]), src: src}, nil
 }
 
 func (nb *Notebook) DecodePage(idx int) (*GrayImage, error) {
@@ -113,18 +150,40 @@ func (nb *Notebook) DecodeLayers(idx int) (*GrayImage, *GrayImage, error) {
 	if err != nil {
 		return nil, nil, fmt.Errorf("main layer: %w", err)
 	}
-	var bgImg *GrayImage
-	if _, ok := pm.Params["BGLAYER"]; ok {
-		if b, err := nb.decodeLayerFromPage(pm, "BGLAYER"); err == nil {
-			bgImg = b
-		} else {
-			log.Printf("background decode failed: %v", err)
-		}
+	bgImg, err := nb.DecodeBackgroundLayer(idx)
+	if err != nil {
+		log.Printf("background decode failed: %v", err)
 	}
 	return mainImg, bgImg, nil
 }
 
-// Composite overlays main over bg using alpha mask (alpha==0 means take background).
+// DecodeBackgroundLayer returns the page template layer, or nil when the page has none.
+func (nb *Notebook) DecodeBackgroundLayer(idx int) (*GrayImage, error) {
+	if idx < 0 || idx >= len(nb.Pages) {
+		return nil, fmt.Errorf("page index out of range")
+	}
+	pm := nb.Pages[idx]
+	if _, ok := pm.Params["BGLAYER"]; !ok {
+		return nil, nil
+	}
+	return nb.decodeLayerFromPage(pm, "BGLAYER")
+}
+
+// DecodeMainLayer returns only the main (ink) layer. Untouched paper keeps the
+// 0xff sentinel with alpha 0, so the result can be written as transparent ink.
+func (nb *Notebook) DecodeMainLayer(idx int) (*GrayImage, error) {
+	if idx < 0 || idx >= len(nb.Pages) {
+		return nil, fmt.Errorf("page index out of range")
+	}
+	img, err := nb.decodeLayerFromPage(nb.Pages[idx], "MAINLAYER")
+	if err != nil {
+		return nil, fmt.Errorf("main layer: %w", err)
+	}
+	return img, nil
+}
+
+// Composite overlays main over bg using alpha mask (alpha==0 means take background;
+// partial alpha from anti-aliased rendering is blended).
 func Composite(main, bg *GrayImage) {
 	if main == nil || bg == nil || main.alpha == nil {
 		return
@@ -138,6 +197,9 @@ func Composite(main, bg *GrayImage) {
 			m[i] = bp[i]
 			a[i] = 255
 			replaced++
+		} else if a[i] < 255 {
+			m[i] = uint8((int(m[i])*int(a[i]) + int(bp[i])*(255-int(a[i])) + 127) / 255)
+			a[i] = 255
 		}
 	}
 	if os.Getenv("TRACE_BG") == "1" {
@@ -188,7 +250,7 @@ func (nb *Notebook) DecodeBackground(idx int) (*GrayImage, error) {
 	}
 	addrStr := pm.Params["BGLAYER"]
 	la, _ := strconv.ParseInt(addrStr, 10, 64)
-	meta, err := readMeta(fileReader, la)
+	meta, err := readMeta(nb.src, la)
 	if err != nil {
 		return nil, err
 	}
@@ -198,39 +260,38 @@ func (nb *Notebook) DecodeBackground(idx int) (*GrayImage, error) {
 		return nil, fmt.Errorf("bg protocol %s unsupported", proto)
 	}
 	bmpAddr, _ := strconv.ParseInt(bmpStr, 10, 64)
-	if _, err := fileReader.Seek(bmpAddr, io.SeekStart); err != nil {
-		return nil, err
-	}
-	var blockLen uint32
-	if err := binary.Read(fileReader, binary.LittleEndian, &blockLen); err != nil {
-		return nil, err
-	}
-	data := make([]byte, blockLen)
-	if _, err := io.ReadFull(fileReader, data); err != nil {
+	data, err := readBlock(nb.src, bmpAddr)
+	if err != nil {
 		return nil, err
 	}
 	allBlank := false
-	if style, ok := pm.Params["PAGESTYLE"]; ok && style == "style_white" && int(blockLen) == specialWhiteStyleBlockSize {
+	if style, ok := pm.Params["PAGESTYLE"]; ok && style == "style_white" && len(data) == specialWhiteStyleBlockSize {
 		allBlank = true
 	}
 	horiz := pm.Params["ORIENTATION"] == "1090"
-	pix, w2, h2, err := decodeRattaRLERef(data, nb.W, nb.H, allBlank, horiz)
+	pix, w2, h2, err := decodeRattaRLERef(getPageBuf(nb.W*nb.H), data, nb.W, nb.H, allBlank, horiz)
 	if err != nil {
 		return nil, err
 	}
 	if len(pix) != w2*h2 {
-		if nb.W != pageWidth || nb.H != pageHeight { // fallback attempt
-			if fpix, fw, fh, ferr := decodeRattaRLERef(data, pageWidth, pageHeight, allBlank, horiz); ferr == nil && len(fpix) == fw*fh {
+		if nb.W != pageWidth || nb.H != pageHeight { // fallback attempt, reusing the short buffer
+			got := len(pix)
+			if fpix, fw, fh, ferr := decodeRattaRLERef(pix, data, pageWidth, pageHeight, allBlank, horiz); ferr == nil && len(fpix) == fw*fh {
 				pix, w2, h2 = fpix, fw, fh
 			} else {
-				return nil, fmt.Errorf("ratta_ref decoded %d != %d (fallback err: %v)", len(pix), w2*h2, ferr)
+				putPageBuf(fpix)
+				return nil, fmt.Errorf("ratta_ref decoded %d != %d (fallback err: %v)", got, w2*h2, ferr)
 			}
 		} else {
 			return nil, fmt.Errorf("ratta_ref decoded %d != %d", len(pix), w2*h2)
 		}
 	}
-	// Build alpha where transparent sentinel 0xff => alpha 0 else 255
-	alpha := make([]byte, len(pix))
+	return newGrayImage(pix, sentinelAlpha(pix), w2, h2), nil
+}
+
+// sentinelAlpha builds a pooled alpha mask where the transparent sentinel 0xff => alpha 0 else 255.
+func sentinelAlpha(pix []byte) []byte {
+	alpha := getPageBuf(len(pix))[:len(pix)]
 	for i, v := range pix {
 		if v == 0xff {
 			alpha[i] = 0
@@ -238,7 +299,7 @@ func (nb *Notebook) DecodeBackground(idx int) (*GrayImage, error) {
 			alpha[i] = 255
 		}
 	}
-	return &GrayImage{pix: pix, alpha: alpha, W: w2, H: h2}, nil
+	return alpha
 }
 
 // decodeLayerFromPage looks up the layer meta via key (MAINLAYER/BGLAYER) then decodes bitmap by protocol.
@@ -248,7 +309,7 @@ func (nb *Notebook) decodeLayerFromPage(pm PageMeta, key string) (*GrayImage, er
 		return nil, fmt.Errorf("layer key %s missing", key)
 	}
 	la, _ := strconv.ParseInt(addrStr, 10, 64)
-	meta, err := readMeta(fileReader, la)
+	meta, err := readMeta(nb.src, la)
 	if err != nil {
 		return nil, err
 	}
@@ -259,29 +320,22 @@ func (nb *Notebook) decodeLayerFromPage(pm PageMeta, key string) (*GrayImage, er
 		return nil, fmt.Errorf("layer bitmap missing in %s meta", key)
 	}
 	bmpAddr, _ := strconv.ParseInt(bmpStr, 10, 64)
-	if _, err := fileReader.Seek(bmpAddr, io.SeekStart); err != nil {
-		return nil, err
-	}
-	var blockLen uint32
-	if err := binary.Read(fileReader, binary.LittleEndian, &blockLen); err != nil {
+	// Load bitmap data block
+	data, err := readBlock(nb.src, bmpAddr)
+	if err != nil {
 		return nil, err
 	}
-	// Load bitmap data block
-	if blockLen < 16 { // heuristic: not a real bitmap, maybe style ref => synthesize neutral background
+	if len(data) < 16 { // heuristic: not a real bitmap, maybe style ref => synthesize neutral background
 		if key == "BGLAYER" {
-			pix := make([]byte, pageWidth*pageHeight)
-			alp := make([]byte, pageWidth*pageHeight)
+			pix := getPageBuf(pageWidth * pageHeight)[:pageWidth*pageHeight]
+			alp := getPageBuf(pageWidth * pageHeight)[:pageWidth*pageHeight]
 			for i := range pix {
 				pix[i] = 0xfe
 				alp[i] = 255
 			}
-			return &GrayImage{pix: pix, alpha: alp, W: pageWidth, H: pageHeight}, nil
+			return newGrayImage(pix, alp, pageWidth, pageHeight), nil
 		}
 	}
-	data := make([]byte, blockLen)
-	if _, err := io.ReadFull(fileReader, data); err != nil {
-		return nil, err
-	}
 	horiz := pm.Params["ORIENTATION"] == "1090"
 	// Detect embedded PNG (signature 89 50 4E 47 0D 0A 1A 0A) even if protocol claims RATTA_RLE.
 	pngSig := []byte{0x89, 'P', 'N', 'G', 0x0D, 0x0A, 0x1A, 0x0A}
@@ -292,8 +346,8 @@ func (nb *Notebook) decodeLayerFromPage(pm PageMeta, key string) (*GrayImage, er
 		}
 		r := img.Bounds()
 		w2, h2 := r.Dx(), r.Dy()
-		pix := make([]byte, w2*h2)
-		alp := make([]byte, w2*h2)
+		pix := getPageBuf(w2 * h2)[:w2*h2]
+		alp := getPageBuf(w2 * h2)[:w2*h2]
 		for y := 0; y < h2; y++ {
 			for x := 0; x < w2; x++ {
 				rc, gc, bc, ac := img.At(x, y).RGBA()
@@ -318,8 +372,8 @@ func (nb *Notebook) decodeLayerFromPage(pm PageMeta, key string) (*GrayImage, er
 		} // auto uses orientation flag
 		if rot == "cw" || rot == "ccw" { // perform 90-degree rotation
 			outW, outH := h2, w2
-			rpix := make([]byte, outW*outH)
-			ralp := make([]byte, outW*outH)
+			rpix := getPageBuf(outW * outH)[:outW*outH]
+			ralp := getPageBuf(outW * outH)[:outW*outH]
 			for y := 0; y < h2; y++ {
 				for x := 0; x < w2; x++ {
 					iOld := y*w2 + x
@@ -336,11 +390,13 @@ func (nb *Notebook) decodeLayerFromPage(pm PageMeta, key string) (*GrayImage, er
 					ralp[iNew] = alp[iOld]
 				}
 			}
+			putPageBuf(pix)
+			putPageBuf(alp)
 			pix, alp = rpix, ralp
 			w2, h2 = outW, outH
 		}
 		// PNG layer decoded successfully
-		return &GrayImage{pix: pix, alpha: alp, W: w2, H: h2}, nil
+		return newGrayImage(pix, alp, w2, h2), nil
 	}
 	// Skip allBlank logic for adaptive decoder
 	switch proto {
@@ -349,11 +405,11 @@ func (nb *Notebook) decodeLayerFromPage(pm PageMeta, key string) (*GrayImage, er
 		var pix []byte
 		var w2, h2 int
 		var err error
-		pix, w2, h2, err = decodeRattaRLERef(data, nb.W, nb.H, false, horiz)
+		pix, w2, h2, err = decodeRattaRLERef(getPageBuf(nb.W*nb.H), data, nb.W, nb.H, false, horiz)
 		if err != nil {
 			// If using non-standard dims, retry with standard dims on mismatch error
 			if (nb.W != pageWidth || nb.H != pageHeight) && strings.Contains(err.Error(), "ratta_ref decoded") {
-				if fpix, fw, fh, ferr := decodeRattaRLERef(data, pageWidth, pageHeight, false, horiz); ferr == nil {
+				if fpix, fw, fh, ferr := decodeRattaRLERef(getPageBuf(pageWidth*pageHeight), data, pageWidth, pageHeight, false, horiz); ferr == nil {
 					pix, w2, h2 = fpix, fw, fh
 					log.Printf("fallback to standard dimensions after mismatch: %v", err)
 					goto sizecheck
@@ -364,11 +420,13 @@ func (nb *Notebook) decodeLayerFromPage(pm PageMeta, key string) (*GrayImage, er
 	sizecheck:
 		expected := w2 * h2
 		if len(pix) != expected {
-			if nb.W != pageWidth || nb.H != pageHeight { // fallback attempt
-				if fpix, fw, fh, ferr := decodeRattaRLERef(data, pageWidth, pageHeight, false, horiz); ferr == nil && len(fpix) == fw*fh {
+			if nb.W != pageWidth || nb.H != pageHeight { // fallback attempt, reusing the short buffer
+				got := len(pix)
+				if fpix, fw, fh, ferr := decodeRattaRLERef(pix, data, pageWidth, pageHeight, false, horiz); ferr == nil && len(fpix) == fw*fh {
 					pix, w2, h2 = fpix, fw, fh
 				} else {
-					return nil, fmt.Errorf("ratta_ref decoded %d != %d (fallback err: %v)", len(pix), expected, ferr)
+					putPageBuf(fpix)
+					return nil, fmt.Errorf("ratta_ref decoded %d != %d (fallback err: %v)", got, expected, ferr)
 				}
 			} else {
 				return nil, fmt.Errorf("ratta_ref decoded %d != %d (exact size required to prevent jaggedness)", len(pix), expected)
@@ -380,15 +438,7 @@ func (nb *Notebook) decodeLayerFromPage(pm PageMeta, key string) (*GrayImage, er
 			validateImageIntegrity(pix, w2, h2)
 		}
 		// Generate alpha from transparent sentinel 0xff
-		alpha := make([]byte, len(pix))
-		for i, v := range pix {
-			if v == 0xff {
-				alpha[i] = 0
-			} else {
-				alpha[i] = 255
-			}
-		}
-		return &GrayImage{pix: pix, alpha: alpha, W: w2, H: h2}, nil
+		return newGrayImage(pix, sentinelAlpha(pix), w2, h2), nil
 	default:
 		return nil, fmt.Errorf("unsupported protocol %s", proto)
 	}
@@ -398,7 +448,7 @@ func (nb *Notebook) decodeLayerFromPage(pm PageMeta, key string) (*GrayImage, er
 func (nb *Notebook) decodeBackgroundVariants(pm PageMeta) (*GrayImage, error) {
 	addrStr := pm.Params["BGLAYER"]
 	la, _ := strconv.ParseInt(addrStr, 10, 64)
-	meta, err := readMeta(fileReader, la)
+	meta, err := readMeta(nb.src, la)
 	if err != nil {
 		return nil, err
 	}
@@ -408,15 +458,8 @@ func (nb *Notebook) decodeBackgroundVariants(pm PageMeta) (*GrayImage, error) {
 		return nil, fmt.Errorf("bg protocol %s unsupported", proto)
 	}
 	bmpAddr, _ := strconv.ParseInt(bmpStr, 10, 64)
-	if _, err := fileReader.Seek(bmpAddr, io.SeekStart); err != nil {
-		return nil, err
-	}
-	var blockLen uint32
-	if err := binary.Read(fileReader, binary.LittleEndian, &blockLen); err != nil {
-		return nil, err
-	}
-	data := make([]byte, blockLen)
-	if _, err := io.ReadFull(fileReader, data); err != nil {
+	data, err := readBlock(nb.src, bmpAddr)
+	if err != nil {
 		return nil, err
 	}
 	horiz := pm.Params["ORIENTATION"] == "1090"
@@ -446,7 +489,7 @@ func (nb *Notebook) decodeBackgroundVariants(pm PageMeta) (*GrayImage, error) {
 		for _, res := range probe {
 			if res.Spec.Name == name && res.Err == nil {
 				// BG using manual spec
-				return &GrayImage{pix: res.Pixels, W: pageWidth, H: pageHeight}, nil
+				return newGrayImage(res.Pixels, nil, pageWidth, pageHeight), nil
 			}
 		}
 		// RLE_SPEC override not found, falling back to auto
@@ -457,7 +500,7 @@ func (nb *Notebook) decodeBackgroundVariants(pm PageMeta) (*GrayImage, error) {
 		for _, r := range probe {
 			if r.Spec == spec {
 				// BG auto spec selected
-				return &GrayImage{pix: r.Pixels, W: pageWidth, H: pageHeight}, nil
+				return newGrayImage(r.Pixels, nil, pageWidth, pageHeight), nil
 			}
 		}
 	}
@@ -677,22 +720,28 @@ func toInt64(v any) int64 {
 		return 0
 	}
 }
-func readMeta(r io.ReadSeeker, addr int64) (map[string]string, error) {
+func readMeta(r io.ReaderAt, addr int64) (map[string]string, error) {
 	if addr == 0 {
 		return map[string]string{}, nil
 	}
-	if _, e := r.Seek(addr, io.SeekStart); e != nil {
+	b, e := readBlock(r, addr)
+	if e != nil {
 		return nil, e
 	}
-	var l uint32
-	if e := binary.Read(r, binary.LittleEndian, &l); e != nil {
+	return parseParams(string(b)), nil
+}
+
+// readBlock reads a length-prefixed block (uint32 LE length followed by data) at addr.
+func readBlock(r io.ReaderAt, addr int64) ([]byte, error) {
+	var lb [addressSize]byte
+	if _, e := r.ReadAt(lb[:], addr); e != nil {
 		return nil, e
 	}
-	b := make([]byte, l)
-	if _, e := io.ReadFull(r, b); e != nil {
+	b := make([]byte, binary.LittleEndian.Uint32(lb[:]))
+	if _, e := r.ReadAt(b, addr+addressSize); e != nil {
 		return nil, e
 	}
-	return parseParams(string(b)), nil
+	return b, nil
 }
 
 var metaRe = regexp.MustCompile(`<([^:<>]+):([^:<>]*)>`)
@@ -837,12 +886,17 @@ func decodeRattaRLE(data []byte, w, h int, allBlank bool, horiz bool) ([]byte, i
 }
 
 // decodeRattaRLERef is a closer line-by-line port of the Python reference logic for comparison.
-func decodeRattaRLERef(data []byte, w, h int, allBlank bool, horiz bool) ([]byte, int, int, error) {
+// Pixels are written into dst's backing array when it has room for w*h bytes.
+func decodeRattaRLERef(dst []byte, data []byte, w, h int, allBlank bool, horiz bool) ([]byte, int, int, error) {
 	if horiz {
 		w, h = h, w
 	}
 	expected := w * h
-	out := make([]byte, 0, expected)
+	out := dst[:0]
+	if cap(out) < expected {
+		putPageBuf(dst)
+		out = getPageBuf(expected)
+	}
 	i := 0
 	haveHolder := false
 	var holdColor, holdLen byte
@@ -940,6 +994,7 @@ func decodeRattaRLERef(data []byte, w, h int, allBlank bool, horiz bool) ([]byte
 		}
 	}
 	if len(out) != expected {
+		putPageBuf(out)
 		return nil, 0, 0, fmt.Errorf("ratta_ref decoded %d != %d", len(out), expected)
 	}
 	return out, w, h, nil
@@ -1275,7 +1330,11 @@ func writeRun(out *[]byte, expected, w int, code byte, length int) {
 			chunk = remain
 		}
 		start := len(*out)
-		*out = append(*out, make([]byte, chunk)...)
+		if start+chunk <= cap(*out) { // decoders preallocate w*h, so this never reallocates
+			*out = (*out)[:start+chunk]
+		} else {
+			*out = append(*out, make([]byte, chunk)...)
+		}
 		b := (*out)[start : start+chunk]
 		for i := 0; i < chunk; i++ {
 			b[i] = g
@@ -1372,74 +1431,6 @@ func logColorStats(data []byte) {
 	log.Println(b.String())
 }
 
-// GrayImage implements image.Image
-type GrayImage struct {
-	pix   []uint8 // grayscale luminance 0=black 255=white
-	alpha []uint8 // optional per-pixel alpha (0 transparent, 255 opaque); length == len(pix) when present
-	W, H  int
-}
-
-func (g *GrayImage) ColorModel() color.Model { return color.GrayModel }
-func (g *GrayImage) Bounds() image.Rectangle { return image.Rect(0, 0, g.W, g.H) }
-func (g *GrayImage) At(x, y int) color.Color {
-	if x < 0 || y < 0 || x >= g.W || y >= g.H {
-		return color.Gray{}
-	}
-	idx := y*g.W + x
-	if g.alpha != nil && idx < len(g.alpha) {
-		// Return an RGBA with alpha preserved
-		v := g.pix[idx]
-		a := g.alpha[idx]
-		return color.NRGBA{R: v, G: v, B: v, A: a}
-	}
-	return color.Gray{Y: g.pix[idx]}
-}
-
-// Pix returns a copy of the underlying pixel slice for read-only iteration.
-func (g *GrayImage) Pix() []uint8 { return g.pix }
-
-// Alpha returns the alpha slice (may be nil if not present)
-func (g *GrayImage) Alpha() []uint8 { return g.alpha }
-
-// SetPix sets a raw pixel (0-based index) if within bounds.
-func (g *GrayImage) SetPix(i int, v uint8) {
-	if i >= 0 && i < len(g.pix) {
-		g.pix[i] = v
-	}
-}
-
-// Histogram returns counts for each grayscale value present.
-func (g *GrayImage) Histogram() map[byte]int {
-	m := make(map[byte]int, 64)
-	for _, p := range g.pix {
-		m[p]++
-	}
-	return m
-}
-
-// UniformRowSample returns indices of up to n rows that are entirely one value (useful for stripe diagnosis).
-func (g *GrayImage) UniformRowSample(n int) []int {
-	if n <= 0 {
-		return nil
-	}
-	res := make([]int, 0, n)
-	for r := 0; r < g.H && len(res) < n; r++ {
-		row := g.pix[r*g.W : (r+1)*g.W]
-		first := row[0]
-		uniform := true
-		for i := 1; i < g.W; i++ {
-			if row[i] != first {
-				uniform = false
-				break
-			}
-		}
-		if uniform {
-			res = append(res, r)
-		}
-	}
-	return res
-}
-
 // validateImageIntegrity checks for patterns that might cause jaggedness
 func validateImageIntegrity(pix []byte, w, h int) {
 	if len(pix) != w*h {
@@ -1,7 +1,9 @@
 package note
 
 import (
+	"bytes"
 	"os"
+	"sync"
 	"testing"
 )
 
@@ -18,4 +20,66 @@ func TestParse(t *testing.T) {
 	if len(nb.Pages) == 0 {
 		t.Errorf("Expected at least one page in parsed note")
 	}
+	if nb.FileID.CreatedAt().IsZero() {
+		t.Errorf("Expected FILE_ID with creation time, got %q", nb.FileID)
+	}
+	for i, pm := range nb.Pages {
+		if pm.ID().CreatedAt().IsZero() {
+			t.Errorf("Expected PAGEID with creation time on page %d, got %q", i, pm.ID())
+		}
+	}
+}
+
+func TestConcurrentDecodeSameNotebook(t *testing.T) {
+	f, err := os.Open("../../../example_notes/example.note")
+	if err != nil {
+		t.Fatalf("failed to open example.note: %v", err)
+	}
+	defer f.Close()
+	nb, err := Parse(f)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	want, err := nb.DecodePage(0)
+	if err != nil {
+		t.Fatalf("DecodePage failed: %v", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := nb.DecodePage(0)
+			if err != nil {
+				t.Errorf("concurrent DecodePage failed: %v", err)
+				return
+			}
+			if !bytes.Equal(got.Pix(), want.Pix()) {
+				t.Errorf("concurrent DecodePage produced different pixels")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkDecodeLayers(b *testing.B) {
+	f, err := os.Open("../../../example_notes/example.note")
+	if err != nil {
+		b.Fatalf("failed to open example.note: %v", err)
+	}
+	defer f.Close()
+	nb, err := Parse(f)
+	if err != nil {
+		b.Fatalf("Parse failed: %v", err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		mainImg, bgImg, err := nb.DecodeLayers(0)
+		if err != nil {
+			b.Fatalf("DecodeLayers failed: %v", err)
+		}
+		Composite(mainImg, bgImg)
+		mainImg.Release()
+		bgImg.Release()
+	}
 }
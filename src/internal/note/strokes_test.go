@@ -0,0 +1,59 @@
+package note
+
+import (
+	"os"
+	"testing"
+)
+
+func TestStrokes(t *testing.T) {
+	f, err := os.Open("../../../example_notes/example.note")
+	if err != nil {
+		t.Fatalf("failed to open example.note: %v", err)
+	}
+	defer f.Close()
+	nb, err := Parse(f)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	strokes, err := nb.Strokes(0)
+	if err != nil {
+		t.Fatalf("Strokes failed: %v", err)
+	}
+	if len(strokes) != 62 {
+		t.Errorf("Expected 62 strokes, got %d", len(strokes))
+	}
+	for i, s := range strokes {
+		if len(s.Points) == 0 {
+			t.Errorf("stroke %d has no points", i)
+		}
+		for _, p := range s.Points {
+			if p.X < 0 || p.X > float64(nb.W)+2 || p.Y < 0 || p.Y > float64(nb.H)+2 {
+				t.Fatalf("stroke %d point (%g,%g) outside %dx%d page", i, p.X, p.Y, nb.W, nb.H)
+			}
+			if p.Pressure < 0 || p.Pressure > 1 {
+				t.Fatalf("stroke %d pressure %g not normalized", i, p.Pressure)
+			}
+		}
+	}
+}
+
+func TestParseStrokesTruncated(t *testing.T) {
+	if _, err := parseStrokes([]byte{1, 0, 0, 0}, 100, 100); err == nil {
+		t.Errorf("Expected error for truncated TOTALPATH block")
+	}
+}
+
+func TestStrokeColorMarkerCodes(t *testing.T) {
+	if g, marker := strokeColor(colMGray); g != 0xc9 || !marker {
+		t.Errorf("colMGray: got gray %#x marker %v", g, marker)
+	}
+	if g, marker := strokeColor(colBlack); g != 0x00 || marker {
+		t.Errorf("colBlack: got gray %#x marker %v", g, marker)
+	}
+	if g, marker := strokeColor(0x00); g != 0x00 || marker {
+		t.Errorf("raw black: got gray %#x marker %v", g, marker)
+	}
+	if PenMarkerV2.Kind() != PenMarker || PenType(99).Kind() != PenInk {
+		t.Errorf("unexpected pen kind mapping")
+	}
+}
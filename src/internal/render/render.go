@@ -0,0 +1,239 @@
+// Package render rasterizes decoded pen strokes at arbitrary resolution.
+package render
+
+import (
+	"image"
+	"math"
+
+	"github.com/merridan/sngo/internal/note"
+)
+
+// Device pen sizes are stored in hundredths; a size of 200 draws roughly a
+// 9px line on the device raster at full pressure.
+const widthUnitPx = 3.0 / 64
+
+// Layer renders strokes onto a new transparent w*h layer, scaling device
+// coordinates by scale. Ink carries its coverage in alpha, so the layer can
+// be composited over a background or written as-is.
+func Layer(strokes []note.Stroke, w, h int, scale float64) *note.GrayImage {
+	dst := note.NewGrayImage(image.Rect(0, 0, w, h), true)
+	alpha := dst.Alpha()
+	for i := range alpha {
+		alpha[i] = 0
+	}
+	Draw(dst, strokes, scale)
+	return dst
+}
+
+// SplitMarkers separates translucent marker strokes from the rest, keeping
+// drawing order. Markers multiply over whatever is under them, template
+// included, so they are drawn once the page below them is complete.
+func SplitMarkers(strokes []note.Stroke) (ink, markers []note.Stroke) {
+	for _, s := range strokes {
+		if brushFor(&s).multiply {
+			markers = append(markers, s)
+		} else {
+			ink = append(ink, s)
+		}
+	}
+	return ink, markers
+}
+
+// Draw renders strokes onto dst, which may be a transparent layer or an
+// opaque page. It returns the rectangle of dst that was touched.
+func Draw(dst *note.GrayImage, strokes []note.Stroke, scale float64) image.Rectangle {
+	var dirty image.Rectangle
+	for i := range strokes {
+		dirty = dirty.Union(drawStroke(dst, &strokes[i], scale))
+	}
+	return dirty
+}
+
+// brush describes how a pen type turns stroke samples into ink.
+type brush struct {
+	pressure    bool    // width follows pen pressure
+	calligraphy bool    // flat nib: width follows stroke direction
+	opacity     float64 // ink coverage at full brush coverage
+	multiply    bool    // translucent ink that darkens what it covers
+}
+
+const (
+	// Flat-nib calligraphy: the nib sits at 45 degrees and the thinnest
+	// stroke (drawn along the nib) is a fifth of the full width.
+	nibAngle    = math.Pi / 4
+	nibMinRatio = 0.2
+	// Markers on the device let roughly half of the page show through.
+	markerOpacity = 0.45
+)
+
+func brushFor(s *note.Stroke) brush {
+	b := brush{opacity: 1}
+	switch s.Pen.Kind() {
+	case note.PenNeedlePoint, note.PenMarker:
+	case note.PenCalligraphy:
+		b.pressure, b.calligraphy = true, true
+	default:
+		b.pressure = true
+	}
+	if s.Translucent {
+		b.opacity, b.multiply = markerOpacity, true
+	}
+	return b
+}
+
+// radius returns the brush radius in output pixels at a sample. dir is the
+// direction of travel in radians, used only by calligraphy nibs.
+func (b brush) radius(s *note.Stroke, p note.Point, dir, scale float64) float64 {
+	r := float64(s.Width) * widthUnitPx * scale / 2
+	if b.pressure {
+		// Light pressure thins the line to half width; full pressure draws the pen size.
+		r *= 0.5 + 0.5*p.Pressure
+	}
+	if b.calligraphy {
+		r *= nibMinRatio + (1-nibMinRatio)*math.Abs(math.Sin(dir-nibAngle))
+	}
+	return r
+}
+
+// drawStroke accumulates the stroke's coverage as a union of round-capped,
+// linearly tapered segments, then blends it over dst in one pass so
+// overlapping segments of the same stroke do not darken each other.
+func drawStroke(dst *note.GrayImage, s *note.Stroke, scale float64) image.Rectangle {
+	if len(s.Points) == 0 {
+		return image.Rectangle{}
+	}
+	b := brushFor(s)
+	pts := make([]point, len(s.Points))
+	for i, p := range s.Points {
+		pts[i] = point{x: p.X * scale, y: p.Y * scale, r: b.radius(s, p, direction(s.Points, i), scale)}
+	}
+
+	bounds := strokeBounds(pts).Intersect(dst.Bounds())
+	if bounds.Empty() {
+		return image.Rectangle{}
+	}
+	cov := newCoverage(bounds)
+	if len(pts) == 1 {
+		cov.capsule(pts[0], pts[0])
+	}
+	for i := 1; i < len(pts); i++ {
+		cov.capsule(pts[i-1], pts[i])
+	}
+	if b.multiply {
+		cov.multiply(dst, s.Color, b.opacity)
+	} else {
+		cov.blend(dst, s.Color, b.opacity)
+	}
+	return bounds
+}
+
+// direction returns the angle of travel at sample i, averaged over the
+// segments on either side of it.
+func direction(pts []note.Point, i int) float64 {
+	prev, next := pts[max(i-1, 0)], pts[min(i+1, len(pts)-1)]
+	return math.Atan2(next.Y-prev.Y, next.X-prev.X)
+}
+
+type point struct{ x, y, r float64 }
+
+func strokeBounds(pts []point) image.Rectangle {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, p := range pts {
+		minX = math.Min(minX, p.x-p.r-1)
+		minY = math.Min(minY, p.y-p.r-1)
+		maxX = math.Max(maxX, p.x+p.r+1)
+		maxY = math.Max(maxY, p.y+p.r+1)
+	}
+	return image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX)), int(math.Ceil(maxY)))
+}
+
+// coverage is a per-stroke anti-aliased mask (0..1) over a bounding box.
+type coverage struct {
+	rect image.Rectangle
+	v    []float32
+}
+
+func newCoverage(r image.Rectangle) *coverage {
+	return &coverage{rect: r, v: make([]float32, r.Dx()*r.Dy())}
+}
+
+// capsule adds a segment from a to b whose radius tapers from a.r to b.r.
+// Coverage is the distance to the segment edge clamped to a one-pixel ramp.
+func (c *coverage) capsule(a, b point) {
+	r := image.Rect(
+		int(math.Floor(math.Min(a.x-a.r, b.x-b.r)-1)), int(math.Floor(math.Min(a.y-a.r, b.y-b.r)-1)),
+		int(math.Ceil(math.Max(a.x+a.r, b.x+b.r)+1)), int(math.Ceil(math.Max(a.y+a.r, b.y+b.r)+1)),
+	).Intersect(c.rect)
+	dx, dy := b.x-a.x, b.y-a.y
+	lenSq := dx*dx + dy*dy
+	w := c.rect.Dx()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		py := float64(y) + 0.5
+		row := c.v[(y-c.rect.Min.Y)*w:]
+		for x := r.Min.X; x < r.Max.X; x++ {
+			px := float64(x) + 0.5
+			t := 0.0
+			if lenSq > 0 {
+				t = ((px-a.x)*dx + (py-a.y)*dy) / lenSq
+				t = math.Max(0, math.Min(1, t))
+			}
+			cx, cy := a.x+t*dx, a.y+t*dy
+			rad := a.r + (b.r-a.r)*t
+			d := math.Hypot(px-cx, py-cy)
+			v := float32(math.Max(0, math.Min(1, rad-d+0.5)))
+			if i := x - c.rect.Min.X; v > row[i] {
+				row[i] = v
+			}
+		}
+	}
+}
+
+// blend composites gray ink with the accumulated coverage (scaled by
+// opacity) over dst using the non-premultiplied "over" operator.
+func (c *coverage) blend(dst *note.GrayImage, gray uint8, opacity float64) {
+	pix, alpha := dst.Pix(), dst.Alpha()
+	w := c.rect.Dx()
+	for y := c.rect.Min.Y; y < c.rect.Max.Y; y++ {
+		row := c.v[(y-c.rect.Min.Y)*w:]
+		for x := c.rect.Min.X; x < c.rect.Max.X; x++ {
+			ca := float64(row[x-c.rect.Min.X]) * opacity
+			if ca <= 0 {
+				continue
+			}
+			i := dst.PixOffset(x, y)
+			da := float64(alpha[i]) / 255
+			oa := ca + da*(1-ca)
+			v := (float64(gray)*ca + float64(pix[i])*da*(1-ca)) / oa
+			pix[i] = uint8(math.Round(v))
+			alpha[i] = uint8(math.Round(oa * 255))
+		}
+	}
+}
+
+// multiply composites translucent ink with the W3C "multiply" blend mode:
+// where the layer already has ink the result is their product, so markers
+// tint writing underneath instead of washing it out; over transparent areas
+// it falls back to plain "over".
+func (c *coverage) multiply(dst *note.GrayImage, gray uint8, opacity float64) {
+	pix, alpha := dst.Pix(), dst.Alpha()
+	cs := float64(gray) / 255
+	w := c.rect.Dx()
+	for y := c.rect.Min.Y; y < c.rect.Max.Y; y++ {
+		row := c.v[(y-c.rect.Min.Y)*w:]
+		for x := c.rect.Min.X; x < c.rect.Max.X; x++ {
+			as := float64(row[x-c.rect.Min.X]) * opacity
+			if as <= 0 {
+				continue
+			}
+			i := dst.PixOffset(x, y)
+			cb := float64(pix[i]) / 255
+			ab := float64(alpha[i]) / 255
+			mixed := (1-ab)*cs + ab*cb*cs
+			oa := as + ab*(1-as)
+			v := (as*mixed + ab*cb*(1-as)) / oa
+			pix[i] = uint8(math.Round(v * 255))
+			alpha[i] = uint8(math.Round(oa * 255))
+		}
+	}
+}
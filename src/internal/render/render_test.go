@@ -0,0 +1,108 @@
+package render
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	"github.com/merridan/sngo/internal/note"
+)
+
+func TestLayerDrawsAntialiasedStroke(t *testing.T) {
+	s := note.Stroke{Width: 200, Points: []note.Point{
+		{X: 10, Y: 20, Pressure: 1},
+		{X: 90, Y: 20, Pressure: 1},
+	}}
+	img := Layer([]note.Stroke{s}, 100, 40, 1)
+	defer img.Release()
+
+	alpha := img.Alpha()
+	if a := alpha[img.PixOffset(50, 20)]; a != 0xff {
+		t.Errorf("Expected opaque ink on the stroke, got alpha %d", a)
+	}
+	if a := alpha[img.PixOffset(50, 2)]; a != 0 {
+		t.Errorf("Expected untouched paper to stay transparent, got alpha %d", a)
+	}
+	partial := false
+	for y := 0; y < 40; y++ {
+		if a := alpha[img.PixOffset(50, y)]; a > 0 && a < 0xff {
+			partial = true
+		}
+	}
+	if !partial {
+		t.Errorf("Expected anti-aliased edge pixels")
+	}
+}
+
+func TestLayerScalesStrokes(t *testing.T) {
+	s := note.Stroke{Width: 200, Points: []note.Point{{X: 10, Y: 10, Pressure: 1}}}
+	img := Layer([]note.Stroke{s}, 40, 40, 2)
+	defer img.Release()
+	if a := img.Alpha()[img.PixOffset(20, 20)]; a != 0xff {
+		t.Errorf("Expected ink at scaled position, got alpha %d", a)
+	}
+}
+
+func TestCalligraphyWidthFollowsDirection(t *testing.T) {
+	pen := note.Stroke{Pen: note.PenCalligraphy, Width: 400}
+	b := brushFor(&pen)
+	p := note.Point{Pressure: 1}
+	along := b.radius(&pen, p, math.Pi/4, 1)
+	across := b.radius(&pen, p, -math.Pi/4, 1)
+	if along >= across {
+		t.Errorf("Expected thin stroke along the nib (%g) and thick across it (%g)", along, across)
+	}
+
+	needle := note.Stroke{Pen: note.PenNeedlePoint, Width: 400}
+	nb := brushFor(&needle)
+	if nb.radius(&needle, note.Point{Pressure: 0.1}, 0, 1) != nb.radius(&needle, note.Point{Pressure: 1}, 0, 1) {
+		t.Errorf("Expected needle point width to ignore pressure")
+	}
+}
+
+func TestMarkerMultipliesOverInk(t *testing.T) {
+	line := func(pen note.PenType, color uint8, translucent bool, y float64) note.Stroke {
+		return note.Stroke{Pen: pen, Color: color, Width: 400, Translucent: translucent,
+			Points: []note.Point{{X: 5, Y: y, Pressure: 1}, {X: 35, Y: y, Pressure: 1}}}
+	}
+	ink := line(note.PenInk, 0x00, false, 20)
+	marker := line(note.PenMarker, 0xc9, true, 20)
+	img := Layer([]note.Stroke{ink, marker}, 40, 40, 1)
+	defer img.Release()
+
+	i := img.PixOffset(20, 20)
+	if img.Pix()[i] != 0x00 || img.Alpha()[i] != 0xff {
+		t.Errorf("Expected marker to leave ink black, got gray %#x alpha %d", img.Pix()[i], img.Alpha()[i])
+	}
+
+	alone := Layer([]note.Stroke{line(note.PenMarker, 0xc9, true, 20)}, 40, 40, 1)
+	defer alone.Release()
+	if a := alone.Alpha()[i]; a == 0 || a == 0xff {
+		t.Errorf("Expected translucent marker over paper, got alpha %d", a)
+	}
+}
+
+func TestMarkerMultipliesOverTemplate(t *testing.T) {
+	ink := note.Stroke{Pen: note.PenInk, Width: 200, Points: []note.Point{{X: 5, Y: 10, Pressure: 1}, {X: 35, Y: 10, Pressure: 1}}}
+	marker := note.Stroke{Pen: note.PenMarker, Color: 0xc9, Width: 400, Translucent: true,
+		Points: []note.Point{{X: 5, Y: 30, Pressure: 1}, {X: 35, Y: 30, Pressure: 1}}}
+	gotInk, markers := SplitMarkers([]note.Stroke{marker, ink})
+	if len(gotInk) != 1 || len(markers) != 1 || !markers[0].Translucent {
+		t.Fatalf("Expected one ink and one marker stroke, got %d and %d", len(gotInk), len(markers))
+	}
+
+	// A template line runs under the marker; markers are drawn on the finished page
+	page := note.NewGrayImage(image.Rect(0, 0, 40, 40), true)
+	defer page.Release()
+	for x := 0; x < 40; x++ {
+		page.Pix()[page.PixOffset(x, 30)] = 0x80
+	}
+	Draw(page, markers, 1)
+	line, paper := page.Pix()[page.PixOffset(20, 30)], page.Pix()[page.PixOffset(20, 28)]
+	if line >= paper || line >= 0x80 {
+		t.Errorf("Expected the template line to show darker through the marker, got line %#x paper %#x", line, paper)
+	}
+	if a := page.Alpha()[page.PixOffset(20, 30)]; a != 0xff {
+		t.Errorf("Expected the page to stay opaque, got alpha %d", a)
+	}
+}
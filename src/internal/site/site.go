@@ -0,0 +1,163 @@
+// Package site builds a self-contained static HTML gallery of converted notes.
+package site
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/merridan/sngo/internal/converter"
+)
+
+// Notebook is one converted note as the site presents it. Paths are
+// slash-separated and relative to the site root.
+type Notebook struct {
+	Name     string
+	Dir      string // folder of the source note relative to the input root ("" at the top)
+	Created  time.Time
+	Cover    string // thumbnail image
+	Pages    []Page
+	Outline  []converter.OutlineEntry
+	Keywords []string
+}
+
+// Page is one page image with its recognized text.
+type Page struct {
+	Image  string
+	Text   string
+	Number int // 1-based page number in the note; 0 numbers pages in order
+}
+
+// number returns the page number of the i-th page shown.
+func (p Page) number(i int) int {
+	if p.Number > 0 {
+		return p.Number
+	}
+	return i + 1
+}
+
+// Href returns the notebook's HTML page relative to the site root.
+func (nb *Notebook) Href() string { return path.Join("notes", nb.Dir, nb.Name+".html") }
+
+// AssetDir returns the folder holding the notebook's images, relative to the site root.
+func (nb *Notebook) AssetDir() string { return path.Join("notes", nb.Dir, nb.Name) }
+
+// folder is a node of the index tree.
+type folder struct {
+	Name      string
+	Folders   []*folder
+	Notebooks []*Notebook
+}
+
+func (f *folder) child(name string) *folder {
+	for _, c := range f.Folders {
+		if c.Name == name {
+			return c
+		}
+	}
+	c := &folder{Name: name}
+	f.Folders = append(f.Folders, c)
+	return c
+}
+
+func (f *folder) sort() {
+	sort.Slice(f.Folders, func(i, j int) bool { return f.Folders[i].Name < f.Folders[j].Name })
+	sort.Slice(f.Notebooks, func(i, j int) bool { return f.Notebooks[i].Name < f.Notebooks[j].Name })
+	for _, c := range f.Folders {
+		c.sort()
+	}
+}
+
+// searchEntry is one record of the client-side search index: a page's
+// recognized text, or a notebook's keywords and titles.
+type searchEntry struct {
+	Notebook string   `json:"n"`
+	Href     string   `json:"h"`
+	Page     int      `json:"p,omitempty"` // 1-based; 0 for notebook-level entries
+	Text     string   `json:"t"`
+	Keywords []string `json:"k,omitempty"`
+}
+
+// Build writes index.html, one HTML page per notebook and search-index.js
+// into outDir. Page images and covers must already exist under outDir.
+func Build(outDir string, notebooks []*Notebook) error {
+	root := &folder{}
+	var index []searchEntry
+	for _, nb := range notebooks {
+		f := root
+		if nb.Dir != "" {
+			for _, part := range strings.Split(nb.Dir, "/") {
+				f = f.child(part)
+			}
+		}
+		f.Notebooks = append(f.Notebooks, nb)
+
+		var titles []string
+		for _, o := range nb.Outline {
+			titles = append(titles, o.Text)
+		}
+		index = append(index, searchEntry{Notebook: nb.Name, Href: nb.Href(), Text: strings.Join(titles, "\n"), Keywords: nb.Keywords})
+		for i, p := range nb.Pages {
+			if p.Text != "" {
+				index = append(index, searchEntry{Notebook: nb.Name, Href: nb.Href(), Page: p.number(i), Text: p.Text})
+			}
+		}
+
+		if err := writeNotebook(outDir, nb); err != nil {
+			return err
+		}
+	}
+	root.sort()
+
+	if err := writeTemplate(filepath.Join(outDir, "index.html"), indexTemplate, root); err != nil {
+		return err
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	// A script rather than JSON so the site also works when opened from disk.
+	js := fmt.Sprintf("window.SEARCH_INDEX = %s;\n", data)
+	return os.WriteFile(filepath.Join(outDir, "search-index.js"), []byte(js), 0644)
+}
+
+func writeNotebook(outDir string, nb *Notebook) error {
+	href := nb.Href()
+	toRoot := strings.Repeat("../", strings.Count(href, "/"))
+	type pageView struct {
+		Number int
+		Image  string
+		Text   string
+	}
+	view := struct {
+		*Notebook
+		Root  string
+		Views []pageView
+	}{Notebook: nb, Root: toRoot}
+	for i, p := range nb.Pages {
+		view.Views = append(view.Views, pageView{Number: p.number(i), Image: toRoot + p.Image, Text: p.Text})
+	}
+	outPath := filepath.Join(outDir, filepath.FromSlash(href))
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return err
+	}
+	return writeTemplate(outPath, notebookTemplate, view)
+}
+
+func writeTemplate(outPath string, t *template.Template, data any) error {
+	file, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	if err := t.Execute(file, data); err != nil {
+		file.Close()
+		return fmt.Errorf("render %s: %w", outPath, err)
+	}
+	return file.Close()
+}
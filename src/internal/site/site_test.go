@@ -0,0 +1,65 @@
+package site
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/merridan/sngo/internal/converter"
+)
+
+func TestBuild(t *testing.T) {
+	out := t.TempDir()
+	notebooks := []*Notebook{
+		{Name: "top"},
+		{
+			Name:     "plan b",
+			Dir:      "Work/Projects",
+			Keywords: []string{"budget"},
+			Outline:  []converter.OutlineEntry{{Page: 1, Level: 2, Text: "Goals <2025>"}},
+			Pages: []Page{
+				{Image: "notes/Work/Projects/plan b/page_000.png"},
+				{Image: "notes/Work/Projects/plan b/page_001.png", Text: "ship the thing"},
+			},
+		},
+	}
+	if err := Build(out, notebooks); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	read := func(rel string) string {
+		data, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(rel)))
+		if err != nil {
+			t.Fatalf("missing %s: %v", rel, err)
+		}
+		return string(data)
+	}
+
+	index := read("index.html")
+	for _, want := range []string{`<summary>Work</summary>`, `<summary>Projects</summary>`, `href="notes/Work/Projects/plan%20b.html"`, `href="notes/top.html"`} {
+		if !strings.Contains(index, want) {
+			t.Errorf("index.html missing %q", want)
+		}
+	}
+
+	page := read("notes/Work/Projects/plan b.html")
+	for _, want := range []string{
+		`href="../../../index.html"`,
+		`src="../../../notes/Work/Projects/plan%20b/page_001.png"`,
+		`loading="lazy"`,
+		`id="page-2"`,
+		`<a href="#page-2">Goals &lt;2025&gt;</a>`,
+		`<pre>ship the thing</pre>`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("notebook page missing %q", want)
+		}
+	}
+
+	search := read("search-index.js")
+	for _, want := range []string{`"t":"ship the thing"`, `"p":2`, `"k":["budget"]`} {
+		if !strings.Contains(search, want) {
+			t.Errorf("search index missing %q: %s", want, search)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package site
+
+import (
+	"fmt"
+	"html/template"
+)
+
+const style = `
+body { font-family: system-ui, sans-serif; margin: 0 auto; max-width: 72rem; padding: 1rem 2rem; color: #222; background: #f6f6f4; }
+a { color: #1a4f8b; text-decoration: none; }
+a:hover { text-decoration: underline; }
+h1 { font-weight: 600; }
+.cards { display: flex; flex-wrap: wrap; gap: 1rem; list-style: none; padding: 0; }
+.card { width: 10rem; }
+.card img { width: 100%; aspect-ratio: 3 / 4; object-fit: cover; background: #fff; border: 1px solid #ccc; }
+.folder { margin-left: 1rem; }
+.folder > summary { font-weight: 600; cursor: pointer; margin: .5rem 0; }
+#search { width: 100%; max-width: 30rem; padding: .5rem; font-size: 1rem; }
+#results li { margin: .4rem 0; }
+#results small { color: #666; display: block; }
+.layout { display: flex; gap: 2rem; align-items: flex-start; }
+nav.outline { position: sticky; top: 1rem; min-width: 12rem; max-width: 16rem; }
+nav.outline ul { list-style: none; padding-left: 0; }
+.page { margin-bottom: 2rem; }
+.page img { width: 100%; height: auto; max-width: 50rem; background: #fff; border: 1px solid #ccc; }
+.page pre { white-space: pre-wrap; font-family: inherit; background: #fff; padding: .5rem; max-width: 49rem; }
+.tags span { background: #e3e8ef; border-radius: 1rem; padding: .1rem .6rem; margin-right: .3rem; font-size: .85rem; }
+`
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Notes</title>
+<style>` + style + `</style>
+</head>
+<body>
+<h1>Notes</h1>
+<input id="search" type="search" placeholder="Search text and keywords" autocomplete="off">
+<ul id="results"></ul>
+{{template "folder" .}}
+<script src="search-index.js"></script>
+<script>
+(function () {
+  var input = document.getElementById("search"), out = document.getElementById("results");
+  function snippet(text, term) {
+    var i = text.toLowerCase().indexOf(term);
+    if (i < 0) return text.slice(0, 120);
+    var start = Math.max(0, i - 40);
+    return (start > 0 ? "…" : "") + text.slice(start, i + 80);
+  }
+  input.addEventListener("input", function () {
+    var terms = input.value.toLowerCase().split(/\s+/).filter(Boolean);
+    out.textContent = "";
+    if (!terms.length) return;
+    var shown = 0;
+    (window.SEARCH_INDEX || []).forEach(function (e) {
+      if (shown >= 50) return;
+      var hay = (e.n + "\n" + e.t + "\n" + (e.k || []).join(" ")).toLowerCase();
+      if (!terms.every(function (t) { return hay.indexOf(t) >= 0; })) return;
+      var li = document.createElement("li"), a = document.createElement("a"), s = document.createElement("small");
+      a.href = e.h + (e.p ? "#page-" + e.p : "");
+      a.textContent = e.n + (e.p ? " – page " + e.p : "");
+      s.textContent = e.k && e.k.length ? e.k.join(", ") : snippet(e.t, terms[0]);
+      li.appendChild(a); li.appendChild(s); out.appendChild(li);
+      shown++;
+    });
+  });
+})();
+</script>
+</body>
+</html>
+{{define "folder"}}
+{{- if .Notebooks}}
+<ul class="cards">
+{{- range .Notebooks}}
+<li class="card"><a href="{{.Href}}"><img src="{{.Cover}}" alt="" loading="lazy"><br>{{.Name}}</a></li>
+{{- end}}
+</ul>
+{{- end}}
+{{- range .Folders}}
+<details class="folder" open>
+<summary>{{.Name}}</summary>
+{{template "folder" .}}
+</details>
+{{- end}}
+{{- end}}
+`))
+
+var notebookTemplate = template.Must(template.New("notebook").Funcs(template.FuncMap{
+	"indent": func(level int) template.CSS {
+		return template.CSS(fmt.Sprintf("padding-left: %drem", min(max(level-1, 0), 3)))
+	},
+	"inc": func(i int) int { return i + 1 },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Name}}</title>
+<style>` + style + `</style>
+</head>
+<body>
+<p><a href="{{.Root}}index.html">&larr; All notes</a></p>
+<h1>{{.Name}}</h1>
+{{- if not .Created.IsZero}}
+<p>Created {{.Created.Format "2006-01-02 15:04"}} &middot; {{len .Pages}} page{{if ne (len .Pages) 1}}s{{end}}</p>
+{{- end}}
+{{- if .Keywords}}
+<p class="tags">{{range .Keywords}}<span>{{.}}</span>{{end}}</p>
+{{- end}}
+<div class="layout">
+{{- if .Outline}}
+<nav class="outline">
+<strong>Outline</strong>
+<ul>
+{{- range .Outline}}
+<li style="{{indent .Level}}"><a href="#page-{{inc .Page}}">{{.Text}}</a></li>
+{{- end}}
+</ul>
+</nav>
+{{- end}}
+<main>
+{{- range .Views}}
+<section class="page" id="page-{{.Number}}">
+<img src="{{.Image}}" alt="Page {{.Number}}" loading="lazy" width="1404" height="1872">
+{{- if .Text}}
+<pre>{{.Text}}</pre>
+{{- end}}
+</section>
+{{- end}}
+</main>
+</div>
+</body>
+</html>
+`))
@@ -0,0 +1,186 @@
+// Package state records what earlier runs converted, so a run can skip notes
+// and pages whose inputs have not changed.
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileName is the state file kept in the output directory
+const FileName = ".supernote-state.json"
+
+// version is bumped when the meaning of recorded hashes changes; a state
+// file of another version is ignored, so the next run rebuilds everything.
+const version = 2
+
+// Note is what a run recorded about one note file
+type Note struct {
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mtime"`
+	Hash     string    `json:"sha256"`   // of the whole file
+	FileID   string    `json:"file_id"`  // FILE_ID from the header
+	Settings string    `json:"settings"` // the options the outputs were made with
+	Output   string    `json:"output"`   // the note's output path without extension, e.g. Work/Meeting
+	Files    []string  `json:"files"`    // outputs written, relative to the output directory
+	Pages    []Page    `json:"pages"`    // by page number; unconverted pages have no file
+	Renames  []Rename  `json:"renames,omitempty"`
+}
+
+// Rename is a move of a note file noticed between runs
+type Rename struct {
+	From string    `json:"from"`
+	To   string    `json:"to"`
+	At   time.Time `json:"at"`
+}
+
+// Page is what a run recorded about one page of a note
+type Page struct {
+	ID   string `json:"id,omitempty"`   // PAGEID
+	Hash string `json:"hash,omitempty"` // of the page content the file was made from
+	File string `json:"file,omitempty"` // relative to the output directory
+}
+
+// State is the state file of one output directory. It is safe for concurrent use.
+//
+// Besides the per-note records it keeps a manifest: every output the tool
+// created and has not removed since. A note's record only lists what its last
+// run wrote, while the manifest still knows the files of deleted pages and
+// notes, so they can be pruned without touching files the tool did not make.
+type State struct {
+	mu       sync.Mutex
+	path     string
+	notes    map[string]*Note
+	manifest map[string]bool
+}
+
+type stateFile struct {
+	Version  int              `json:"version"`
+	Notes    map[string]*Note `json:"notes"`
+	Manifest []string         `json:"manifest"` // relative to the output directory
+}
+
+// Load reads the state file in outDir. A missing file gives an empty state.
+func Load(outDir string) (*State, error) {
+	s := &State{path: filepath.Join(outDir, FileName), notes: map[string]*Note{}, manifest: map[string]bool{}}
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	var f stateFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return s, fmt.Errorf("%s: %v", s.path, err)
+	}
+	if f.Version != version {
+		return s, fmt.Errorf("%s: unsupported version %d", s.path, f.Version)
+	}
+	if f.Notes != nil {
+		s.notes = f.Notes
+	}
+	// Records are part of the manifest too, for state files written before it
+	for _, n := range s.notes {
+		s.track(n.Files...)
+	}
+	s.track(f.Manifest...)
+	return s, nil
+}
+
+// Path returns the state file's path
+func (s *State) Path() string { return s.path }
+
+// Note returns the record of a note file, or nil if there is none.
+func (s *State) Note(path string) *Note {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.notes[path]
+}
+
+// SetNote replaces the record of a note file.
+func (s *State) SetNote(path string, n *Note) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notes[path] = n
+}
+
+// DeleteNote removes the record of a note file.
+func (s *State) DeleteNote(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.notes, path)
+}
+
+// Save writes the state file, replacing it atomically.
+func (s *State) Save() error {
+	s.mu.Lock()
+	data, err := json.MarshalIndent(stateFile{Version: version, Notes: s.notes, Manifest: s.sortedManifest()}, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Paths returns the note files with a record, sorted.
+func (s *State) Paths() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	paths := make([]string, 0, len(s.notes))
+	for p := range s.notes {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Track adds outputs the tool created to the manifest.
+func (s *State) Track(files ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.track(files...)
+}
+
+func (s *State) track(files ...string) {
+	for _, f := range files {
+		s.manifest[f] = true
+	}
+}
+
+// Untrack removes outputs that were removed or moved from the manifest.
+func (s *State) Untrack(files ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range files {
+		delete(s.manifest, f)
+	}
+}
+
+// Manifest returns every tracked output, sorted.
+func (s *State) Manifest() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedManifest()
+}
+
+func (s *State) sortedManifest() []string {
+	files := make([]string, 0, len(s.manifest))
+	for f := range s.manifest {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	return files
+}
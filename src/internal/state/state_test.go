@@ -0,0 +1,58 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load of an empty directory failed: %v", err)
+	}
+	mtime := time.Date(2025, 8, 29, 17, 6, 23, 0, time.UTC)
+	s.SetNote("Work/a.note", &Note{
+		Size: 42, ModTime: mtime, Hash: "abc", FileID: "F1", Settings: "png",
+		Files: []string{"Work/a/page_000.png"},
+		Pages: []Page{{ID: "P1", Hash: "def", File: "Work/a/page_000.png"}},
+	})
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	s, err = Load(dir)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	n := s.Note("Work/a.note")
+	if n == nil {
+		t.Fatal("Expected the saved note record")
+	}
+	if n.Size != 42 || !n.ModTime.Equal(mtime) || n.FileID != "F1" || len(n.Pages) != 1 || n.Pages[0].Hash != "def" {
+		t.Errorf("Record did not survive a round trip: %+v", n)
+	}
+	if got := s.Paths(); len(got) != 1 || got[0] != "Work/a.note" {
+		t.Errorf("Paths() = %q", got)
+	}
+	// Recorded outputs are in the manifest even if never tracked explicitly
+	if got := s.Manifest(); len(got) != 1 || got[0] != "Work/a/page_000.png" {
+		t.Errorf("Manifest() = %q", got)
+	}
+}
+
+func TestLoadOtherVersion(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(`{"version": 999, "notes": {"a.note": {}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Load(dir)
+	if err == nil {
+		t.Error("Expected an error for an unknown version")
+	}
+	if s == nil || s.Note("a.note") != nil {
+		t.Error("Expected an empty state to start over with")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/merridan/sngo/internal/converter"
+	"github.com/merridan/sngo/internal/logging"
+	"github.com/merridan/sngo/internal/note"
+)
+
+// Page layouts selected with -layout
+const (
+	layoutPages  = "pages"  // one PNG per page
+	layoutScroll = "scroll" // all pages stitched into one tall PNG
+	layoutGrid   = "grid"   // contact sheet of page thumbnails
+)
+
+// writeNotebookSheet writes all pages of nb as one PNG laid out per
+// opts.layout. Pages of each sheet row are rendered in parallel on the page
+// pool and streamed into the encoder, so long notebooks never sit in memory.
+func writeNotebookSheet(nb *note.Notebook, pageNums []int, outPath string, modTime time.Time, opts *convertOptions) error {
+	scale := opts.scaleFor(nb)
+	sopts := opts.sheet
+	if opts.layout == layoutScroll {
+		sopts.Columns, sopts.CellWidth, sopts.Labels = 1, 0, false
+	}
+	for _, pageNum := range pageNums {
+		sopts.Numbers = append(sopts.Numbers, pageNum+1)
+	}
+	w := int(math.Round(float64(nb.W) * scale))
+	h := int(math.Round(float64(nb.H) * scale))
+	sheet, err := converter.NewSheet(len(pageNums), w, h, sopts)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %v", filepath.Dir(outPath), err)
+	}
+	file, err := createOutput(outPath)
+	if err != nil {
+		return err
+	}
+	err = sheet.EncodePNG(file, opts.png.Options().Compression, func(first, n int) ([]image.Image, error) {
+		imgs := make([]image.Image, n)
+		errs := make([]error, n)
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				opts.pool.Do(func() {
+					imgs[i], errs[i] = converter.ConvertPageToImageAt(nb, pageNums[first+i], scale)
+				})
+			}(i)
+		}
+		wg.Wait()
+		for i, err := range errs {
+			if err != nil {
+				for _, img := range imgs {
+					releaseImage(img)
+				}
+				return nil, fmt.Errorf("page %d: %w", pageNums[first+i], err)
+			}
+		}
+		return imgs, nil
+	})
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("write %s: %w", outPath, err)
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	setModTime(outPath, modTime)
+	b := sheet.Bounds()
+	logging.Info("wrote %s (%d pages, %dx%d)", outPath, len(pageNums), b.Dx(), b.Dy())
+	return nil
+}
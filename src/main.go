@@ -3,253 +3,273 @@ package main
 import (
 	"flag"
 	"fmt"
-	"image"
-	"image/png"
 	"log"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/merridan/sngo/internal/config"
+	"github.com/merridan/sngo/internal/converter"
 	"github.com/merridan/sngo/internal/logging"
-	"github.com/merridan/sngo/internal/note"
 )
 
-// findNoteFiles finds all .note files in a directory
-func findNoteFiles(dir string, recursive bool) ([]string, error) {
-	var noteFiles []string
+// stringList is a flag that can be given several times
+type stringList []string
 
-	if recursive {
-		err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
-			if err != nil {
-				return err
-			}
-			if !d.IsDir() && strings.HasSuffix(strings.ToLower(path), ".note") {
-				noteFiles = append(noteFiles, path)
-			}
-			return nil
-		})
-		return noteFiles, err
-	} else {
-		entries, err := os.ReadDir(dir)
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// notePageSpecs matches the per-note page specs of config.json to notes.
+// Keys are a note's path relative to the input directory ("Journal/Daily.note")
+// or just its file name ("Daily.note"); the relative path wins.
+func notePageSpecs(specs map[string]string, inputs []noteInput, oneBased bool) (map[string]*converter.PageSpec, error) {
+	parsed := map[string]*converter.PageSpec{}
+	for key, text := range specs {
+		spec, err := converter.ParsePageSpec(text, oneBased)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("%s: %v", key, err)
 		}
-		for _, entry := range entries {
-			if !entry.IsDir() && strings.HasSuffix(strings.ToLower(entry.Name()), ".note") {
-				noteFiles = append(noteFiles, filepath.Join(dir, entry.Name()))
+		parsed[filepath.ToSlash(key)] = spec
+	}
+	out := map[string]*converter.PageSpec{}
+	used := map[string]bool{}
+	for _, in := range inputs {
+		rel, err := filepath.Rel(in.root, in.path)
+		if err != nil || in.root == "" {
+			rel = in.path
+		}
+		for _, key := range []string{filepath.ToSlash(rel), filepath.Base(in.path)} {
+			if spec, ok := parsed[key]; ok {
+				out[in.path] = spec
+				used[key] = true
+				break
 			}
 		}
-		return noteFiles, nil
 	}
+	for key := range parsed {
+		if !used[key] {
+			logging.Warn("config.json pages: %s matches no note", key)
+		}
+	}
+	return out, nil
 }
 
 func main() {
-	in := flag.String("in", "", "input directory containing .note files (uses supernote_path from config.json if blank)")
+	if len(os.Args) > 1 && os.Args[1] == "site" {
+		runSite(os.Args[2:])
+		return
+	}
+	// `supernote-tool watch` takes the same flags and keeps converting as notes change
+	args, watching := os.Args[1:], false
+	if len(args) > 0 && args[0] == "watch" {
+		args, watching = args[1:], true
+	}
+
+	in := flag.String("in", "", "input directory or .note file, in addition to any paths after the flags (uses supernote_path from config.json if no input is given)")
 	outDir := flag.String("out-dir", "", "output directory for all generated PNG files")
+	flat := flag.Bool("flat", false, "write every note directly into -out-dir instead of mirroring the input folders")
+	nameTemplate := flag.String("name-template", "", "page file names relative to -out-dir, e.g. \"{dir}/{note}_{page1}.{ext}\"; placeholders: {dir} {note} {page} {page1} {pageid} {title} {created} {ext} (default \""+converter.DefaultNameTemplate+"\", or name_template from config.json)")
 	logLevel := flag.String("log-level", "info", "logging level: debug, info, warn, error")
 	numWorkers := flag.Int("workers", 8, "number of parallel workers for processing notes")
-	flag.Parse()
-
-	logging.SetLevel(*logLevel)
-
-	// Load configuration
-	cfg, err := config.Load()
-	if err != nil {
-		log.Fatalf("failed to load config: %v", err)
+	pageWorkers := flag.Int("page-workers", 0, "number of pages decoded and encoded in parallel, shared across notes (default: same as -workers)")
+	pngCompression := flag.String("png-compression", "default", "PNG compression: default, speed, best, none")
+	palette := flag.Bool("palette", false, "write compact 2/4-bit paletted PNGs when a page uses at most 16 gray levels (lossless)")
+	inkOnly := flag.Bool("ink-only", false, "skip the page background and write RGBA PNGs with transparent paper")
+	dpi := flag.Int("dpi", 0, "render strokes at this resolution (e.g. 600) instead of the device raster")
+	scale := flag.Float64("scale", 0, "render strokes at this multiple of the device raster (e.g. 2)")
+	format := flag.String("format", formatPNG, "output format: png, gif (stroke replay animation), frames (stroke replay as PNG frames), tiff (one multi-page TIFF per note), markdown (PNG pages plus a .md per note), epub (one fixed-layout EPUB per note)")
+	fps := flag.Float64("fps", 10, "frames per second for gif and frames output")
+	strokesPerFrame := flag.Int("strokes-per-frame", 1, "strokes added between replay frames")
+	hold := flag.Duration("hold", 0, "how long replays stay on the finished page (e.g. 2s)")
+	layout := flag.String("layout", layoutPages, "page layout for png output: pages (one file per page), scroll (one tall image), grid (contact sheet)")
+	gap := flag.Int("gap", 32, "pixels between pages in scroll and grid layouts")
+	separator := flag.Int("separator", 0, "thickness of a gray line drawn in the gap between pages or grid rows (0 = none)")
+	columns := flag.Int("columns", 4, "pages per row in the grid layout")
+	cellWidth := flag.Int("cell-width", 351, "width of each page thumbnail in the grid layout")
+	pages := flag.String("pages", "", "pages to convert, e.g. \"0-4\", \"2,5,9\", \"5-\" (to the end), \"-3-\" (last three), odd, even (default all)")
+	oneBased := flag.Bool("one-based", false, "count page numbers in -pages and config.json from 1 instead of 0")
+	var include, exclude stringList
+	flag.Var(&include, "include", "only convert notes matching this glob, e.g. \"Work/**\" or \"*Meeting*\" (repeatable); patterns without a slash match file names")
+	flag.Var(&exclude, "exclude", "skip notes and folders matching this glob, e.g. EXPORT or \"*conflict*\" (repeatable)")
+	hidden := flag.Bool("hidden", false, "also search folders whose name starts with a dot, such as .Trash")
+	force := flag.Bool("force", false, "convert every note, even if it is unchanged since the last run into -out-dir")
+	prune := flag.Bool("prune", false, "after converting, remove outputs in -out-dir the tool created earlier that the given notes no longer produce")
+	dryRun := flag.Bool("dry-run", false, "with -prune, only list what would be removed; nothing is converted or written")
+	debounce := flag.Duration("debounce", 2*time.Second, "watch: how long a changed note must stay unchanged before it is converted")
+	pollInterval := flag.Duration("poll-interval", 0, "watch: scan for changes at this interval instead of using file system notifications (e.g. 10s, for network shares)")
+	toStdout := flag.Bool("stdout", false, "write the output to standard output: one note, and a single page or a single-file format (tiff, epub, scroll, grid)")
+	flag.Usage = func() {
+		name := filepath.Base(os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [path ...]\n       %s watch [flags] [path ...]\n       %s site [flags]\n\nPaths are .note files or directories searched recursively; - reads a note from standard input.\nwatch converts once, then again whenever notes change, until interrupted.\n\n", name, name, name)
+		flag.PrintDefaults()
 	}
+	flag.CommandLine.Parse(args)
 
-	// If no input directory specified, use supernote_path from config
-	resolvedInput := *in
-	if resolvedInput == "" {
-		if cfg.SupernotePath == "" {
-			log.Fatal("supernote_path not configured in config.json and no input directory provided")
-		}
-		resolvedInput = cfg.SupernotePath
+	if *numWorkers < 1 {
+		log.Fatal("-workers must be at least 1")
 	}
-
-	// Check that the input directory exists
-	if _, err := os.Stat(resolvedInput); err != nil {
-		log.Fatal(err)
+	if *pageWorkers < 0 {
+		log.Fatal("-page-workers must not be negative")
 	}
-
-	// Always process recursively
-	noteFiles, err := findNoteFiles(resolvedInput, true)
-	if err != nil {
-		log.Fatalf("failed to find .note files in directory: %v", err)
+	if *pageWorkers == 0 {
+		*pageWorkers = *numWorkers
 	}
-	if len(noteFiles) == 0 {
-		log.Fatalf("no .note files found in directory: %s", resolvedInput)
+	if *dpi != 0 && *scale != 0 {
+		log.Fatal("-dpi and -scale are mutually exclusive")
+	}
+	if *dpi < 0 || *scale < 0 {
+		log.Fatal("-dpi and -scale must be positive")
 	}
-	logging.Info("Found %d .note file(s) in directory", len(noteFiles))
-
-	// Parallel worker pool
-	jobs := make(chan string, *numWorkers)
-	results := make(chan error, len(noteFiles))
 
-	// Worker function
-	worker := func(id int) {
-		for noteFile := range jobs {
-			logging.Info("Worker %d processing: %s", id, filepath.Base(noteFile))
-			err := processNoteFile(noteFile, *outDir)
-			if err != nil {
-				logging.Error("failed to process %s: %v", noteFile, err)
-			}
-			results <- err
+	switch *format {
+	case formatPNG, formatGIF, formatFrames, formatTIFF, formatMarkdown, formatEPUB:
+	default:
+		log.Fatalf("unknown -format %q (want png, gif, frames, tiff, markdown or epub)", *format)
+	}
+	switch *layout {
+	case layoutPages:
+	case layoutScroll, layoutGrid:
+		if *format != formatPNG {
+			log.Fatalf("-layout %s only applies to -format png", *layout)
 		}
+		if *gap < 0 || *separator < 0 || *separator > *gap || *columns <= 0 || *cellWidth <= 0 {
+			log.Fatal("-gap, -columns and -cell-width must be positive and -separator must fit in the gap")
+		}
+	default:
+		log.Fatalf("unknown -layout %q (want pages, scroll or grid)", *layout)
 	}
-
-	// Start workers
-	for w := 0; w < *numWorkers; w++ {
-		go worker(w)
+	// Only page files and replays keep transparent paper; the other writers
+	// always composite the background
+	if *inkOnly && (*format == formatTIFF || *format == formatEPUB) {
+		log.Fatalf("-ink-only does not work with -format %s, whose pages always include the background", *format)
 	}
-
-	// Send jobs
-	for _, noteFile := range noteFiles {
-		jobs <- noteFile
+	if *inkOnly && *layout != layoutPages {
+		log.Fatalf("-ink-only does not work with -layout %s, which lays pages out on white", *layout)
 	}
-	close(jobs)
-
-	// Wait for all results
-	for i := 0; i < len(noteFiles); i++ {
-		<-results
+	if *fps <= 0 || *strokesPerFrame <= 0 || *hold < 0 {
+		log.Fatal("-fps and -strokes-per-frame must be positive and -hold must not be negative")
+	}
+	if *toStdout && (*format == formatFrames || *format == formatMarkdown) {
+		log.Fatalf("-stdout does not work with -format %s, which writes several files", *format)
+	}
+	if *toStdout && *prune {
+		log.Fatal("-prune needs an output directory and does not work with -stdout")
+	}
+	if *dryRun && !*prune {
+		log.Fatal("-dry-run only applies to -prune")
+	}
+	if watching && *dryRun {
+		log.Fatal("-dry-run converts nothing and does not work with watch")
+	}
+	if watching && *toStdout {
+		log.Fatal("watch writes to -out-dir and does not work with -stdout")
+	}
+	if *debounce < 0 || *pollInterval < 0 {
+		log.Fatal("-debounce and -poll-interval must not be negative")
 	}
-}
 
-// processNoteFile processes a single .note file for PNG generation (all pages)
-func processNoteFile(inputPath string, outDir string) error {
-	f, err := os.Open(inputPath)
-	if err != nil {
-		return fmt.Errorf("failed to open %s: %v", inputPath, err)
+	logging.SetLevel(*logLevel)
+	if *toStdout {
+		// Keep standard output for the image data
+		logging.SetInfoOutput(os.Stderr)
 	}
-	defer f.Close()
 
-	nb, err := note.Parse(f)
+	level, err := converter.ParseCompressionLevel(*pngCompression)
 	if err != nil {
-		return fmt.Errorf("failed to parse %s: %v", inputPath, err)
+		log.Fatal(err)
 	}
 
-	// Create a subdirectory for this .note file
-	baseName := strings.TrimSuffix(filepath.Base(inputPath), ".note")
-	noteDir := baseName
-	if outDir != "" {
-		noteDir = filepath.Join(outDir, baseName)
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
 	}
 
-	if err := os.MkdirAll(noteDir, 0755); err != nil {
-		return fmt.Errorf("failed to create directory %s: %v", noteDir, err)
+	// If no input is specified, use supernote_path from config
+	paths := flag.Args()
+	if *in != "" {
+		paths = append([]string{*in}, paths...)
 	}
-
-	// Process all pages
-	for pageNum := range nb.Pages {
-		pageFileName := fmt.Sprintf("page_%03d.png", pageNum)
-		pageOutputPath := filepath.Join(noteDir, pageFileName)
-		img, err := convertPageToImage(nb, pageNum)
-		if err != nil {
-			logging.Error("failed to convert page %d in %s: %v", pageNum, inputPath, err)
-			continue
-		}
-		if err := saveImage(img, pageOutputPath); err != nil {
-			logging.Error("failed to save page %d in %s: %v", pageNum, inputPath, err)
-			continue
+	if len(paths) == 0 {
+		if cfg.SupernotePath == "" {
+			log.Fatal("supernote_path not configured in config.json and no input provided")
 		}
-		logging.Info("wrote %s", pageOutputPath)
+		paths = []string{cfg.SupernotePath}
 	}
-	return nil
-}
 
-// convertPageToImage converts a single page from a parsed note to an image
-func convertPageToImage(nb *note.Notebook, pageNum int) (image.Image, error) {
-	if pageNum < 0 || pageNum >= len(nb.Pages) {
-		return nil, fmt.Errorf("page %d out of range (0-%d)", pageNum, len(nb.Pages)-1)
+	names, err := parseNameTemplate(*nameTemplate, cfg.NameTemplate, *flat)
+	if err != nil {
+		log.Fatal(err)
 	}
-
-	// Convert the page
-	mainImg, bgImg, err := nb.DecodeLayers(pageNum)
+	pageSpec, err := converter.ParsePageSpec(*pages, *oneBased)
 	if err != nil {
-		return nil, fmt.Errorf("decode page: %w", err)
+		log.Fatalf("invalid -pages: %v", err)
 	}
 
-	// Composite background under main layer if present
-	if bgImg != nil {
-		note.Composite(mainImg, bgImg)
+	// Two-level scheduler: -workers file workers parse notes and fan their
+	// pages out onto a page pool sized by -page-workers, shared by every note.
+	opts := &convertOptions{
+		pool: newPagePool(*pageWorkers),
+		png: converter.NewPNGEncoder(converter.PNGOptions{
+			Compression: level,
+			Paletted:    *palette,
+			KeepAlpha:   *inkOnly,
+		}),
+		inkOnly: *inkOnly,
+		scale:   *scale,
+		dpi:     *dpi,
+		format:  *format,
+		replay: converter.ReplayOptions{
+			FPS:             *fps,
+			StrokesPerFrame: *strokesPerFrame,
+			Hold:            *hold,
+		},
+		layout: *layout,
+		names:  names,
+		pages:  pageSpec,
+		stdout: *toStdout,
+		force:  *force,
+		sheet: converter.SheetOptions{
+			Columns:   *columns,
+			CellWidth: *cellWidth,
+			Gap:       *gap,
+			Separator: *separator,
+			Labels:    true,
+		},
 	}
-
-	return mainImg, nil
-}
-
-// parsePageSpec parses a page specification and returns a slice of page numbers
-func parsePageSpec(spec string, totalPages int) ([]int, error) {
-	spec = strings.TrimSpace(spec)
-	if spec == "" || spec == "*" || spec == "all" {
-		// Return all pages
-		pages := make([]int, totalPages)
-		for i := range pages {
-			pages[i] = i
-		}
-		return pages, nil
+	// The state file remembers what earlier runs wrote, so unchanged notes are skipped
+	if !*toStdout {
+		opts.state = loadState(*outDir)
 	}
-
-	var pages []int
-
-	// Split by commas for multiple ranges/numbers
-	parts := strings.Split(spec, ",")
-	for _, part := range parts {
-		part = strings.TrimSpace(part)
-
-		if strings.Contains(part, "-") {
-			// Handle range like "1-3"
-			rangeParts := strings.Split(part, "-")
-			if len(rangeParts) != 2 {
-				return nil, fmt.Errorf("invalid range format: %s", part)
-			}
-
-			start, err := strconv.Atoi(strings.TrimSpace(rangeParts[0]))
-			if err != nil {
-				return nil, fmt.Errorf("invalid start page: %s", rangeParts[0])
-			}
-
-			end, err := strconv.Atoi(strings.TrimSpace(rangeParts[1]))
-			if err != nil {
-				return nil, fmt.Errorf("invalid end page: %s", rangeParts[1])
-			}
-
-			if start > end {
-				return nil, fmt.Errorf("start page %d is greater than end page %d", start, end)
-			}
-
-			for i := start; i <= end; i++ {
-				if i < 0 || i >= totalPages {
-					return nil, fmt.Errorf("page %d out of range (0-%d)", i, totalPages-1)
-				}
-				pages = append(pages, i)
-			}
-		} else {
-			// Handle single page number
-			pageNum, err := strconv.Atoi(part)
-			if err != nil {
-				return nil, fmt.Errorf("invalid page number: %s", part)
-			}
-
-			if pageNum < 0 || pageNum >= totalPages {
-				return nil, fmt.Errorf("page %d out of range (0-%d)", pageNum, totalPages-1)
-			}
-
-			pages = append(pages, pageNum)
-		}
+	// Directories are always searched recursively; filters only apply there
+	r := &runner{
+		paths:     paths,
+		filter:    &noteFilter{include: include, exclude: exclude, hidden: *hidden},
+		outDir:    *outDir,
+		flat:      *flat,
+		workers:   *numWorkers,
+		pageSpecs: cfg.Pages,
+		oneBased:  *oneBased,
+		prune:     *prune,
+		dryRun:    *dryRun,
+		opts:      opts,
+	}
+	if watching {
+		r.watch(*debounce, *pollInterval)
+		return
 	}
 
-	return pages, nil
-}
-
-// saveImage saves an image to a file
-func saveImage(img image.Image, filename string) error {
-	outF, err := os.Create(filename)
+	// Any failure makes the exit status non-zero for scripts
+	stats, err := r.run(nil)
 	if err != nil {
-		return err
+		log.Fatal(err)
+	}
+	if stats.failed.Load() > 0 {
+		os.Exit(1)
 	}
-	defer outF.Close()
-
-	return png.Encode(outF, img)
 }
@@ -1,14 +1,30 @@
 package main
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"image/png"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/merridan/sngo/internal/converter"
+	"github.com/merridan/sngo/internal/note"
 )
 
 func TestFindNoteFiles(t *testing.T) {
 	dir := "../example_notes"
-	files, err := findNoteFiles(dir, true)
+	files, err := findNoteFiles(dir, nil)
 	if err != nil {
 		t.Fatalf("findNoteFiles failed: %v", err)
 	}
@@ -26,15 +42,388 @@ func TestProcessNoteFile(t *testing.T) {
 	notePath := "../example_notes/example.note"
 	outDir := "../build/test_output"
 	os.RemoveAll(outDir)
-	err := processNoteFile(notePath, outDir)
+	opts := &convertOptions{pool: newPagePool(4), png: converter.NewPNGEncoder(converter.PNGOptions{Compression: png.BestSpeed})}
+	outputs, err := planOutputs([]noteInput{{path: notePath, root: ".."}}, outDir, false)
+	if err != nil {
+		t.Fatalf("planOutputs failed: %v", err)
+	}
+	err = processNoteFile(notePath, outputs[notePath], opts)
 	if err != nil {
 		t.Fatalf("processNoteFile failed: %v", err)
 	}
-	// Check output dir exists
-	baseName := filepath.Base(notePath)
-	baseName = baseName[:len(baseName)-len(filepath.Ext(baseName))]
-	noteOutDir := filepath.Join(outDir, baseName)
+	// Check output dir exists, mirroring the input folders
+	noteOutDir := filepath.Join(outDir, "example_notes", "example")
 	if _, err := os.Stat(noteOutDir); err != nil {
 		t.Errorf("Output directory %s not created", noteOutDir)
 	}
 }
+
+func TestProcessNoteFileReplayFrames(t *testing.T) {
+	outDir := t.TempDir()
+	opts := &convertOptions{
+		pool:   newPagePool(2),
+		png:    converter.NewPNGEncoder(converter.PNGOptions{Compression: png.BestSpeed}),
+		format: formatFrames,
+		replay: converter.ReplayOptions{FPS: 2, StrokesPerFrame: 100, Hold: time.Second},
+	}
+	// Leftovers of an earlier, longer replay, next to a file of the user's
+	frameDir := filepath.Join(outDir, "example", "page_000")
+	os.MkdirAll(frameDir, 0755)
+	for _, name := range []string{"frame_0004.png", "frame_0010.png", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(frameDir, name), []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := processNoteFile("../example_notes/example.note", noteOutput{root: outDir, rel: "example"}, opts); err != nil {
+		t.Fatalf("processNoteFile failed: %v", err)
+	}
+	frames, err := filepath.Glob(filepath.Join(frameDir, "frame_*.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Blank page, all strokes, then two hold frames
+	if len(frames) != 4 {
+		t.Errorf("Expected 4 frames, got %v", frames)
+	}
+	if _, err := os.Stat(filepath.Join(frameDir, "notes.txt")); err != nil {
+		t.Errorf("Expected files other than frames to be kept: %v", err)
+	}
+}
+
+func TestCollectInputs(t *testing.T) {
+	notePath := filepath.Join("..", "example_notes", "example.note")
+	inputs, err := collectInputs([]string{notePath, filepath.Join("..", "example_notes"), "-"}, nil)
+	if err != nil {
+		t.Fatalf("collectInputs failed: %v", err)
+	}
+	// The note is found twice but converted once, as named first
+	want := []noteInput{{path: notePath}, {path: stdinPath}}
+	if len(inputs) != 2 || inputs[0] != want[0] || inputs[1] != want[1] {
+		t.Errorf("Expected %v, got %v", want, inputs)
+	}
+	if _, err := collectInputs([]string{"does-not-exist.note"}, nil); err == nil {
+		t.Error("Expected an error for a missing path")
+	}
+}
+
+func TestProcessNoteFromStdinToStdout(t *testing.T) {
+	in, err := os.Open("../example_notes/example.note")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	out, err := os.Create(filepath.Join(t.TempDir(), "page.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	stdin, stdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = in, out
+	defer func() { os.Stdin, os.Stdout = stdin, stdout }()
+
+	opts := &convertOptions{pool: newPagePool(2), png: converter.NewPNGEncoder(converter.PNGOptions{Compression: png.BestSpeed}), stdout: true}
+	if err := processNoteFile(stdinPath, noteOutput{rel: "stdin"}, opts); err != nil {
+		t.Fatalf("processNoteFile failed: %v", err)
+	}
+	out.Seek(0, 0)
+	img, err := png.Decode(out)
+	if err != nil {
+		t.Fatalf("Expected a PNG on standard output: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 1404 || b.Dy() != 1872 {
+		t.Errorf("Unexpected page size %v", b)
+	}
+}
+
+func TestPlanOutputs(t *testing.T) {
+	in := "notes"
+	files := []string{
+		filepath.Join(in, "Work", "Meeting.note"),
+		filepath.Join(in, "Personal", "Meeting.note"),
+		filepath.Join(in, "Personal", "meeting.NOTE"),
+		filepath.Join(in, "Meeting_2.note"),
+	}
+	var inputs []noteInput
+	for _, f := range files {
+		inputs = append(inputs, noteInput{path: f, root: in})
+	}
+	mirrored, err := planOutputs(inputs, "out", false)
+	if err != nil {
+		t.Fatalf("planOutputs failed: %v", err)
+	}
+	for file, want := range map[string]string{
+		files[0]: filepath.Join("out", "Work", "Meeting"),
+		files[1]: filepath.Join("out", "Personal", "Meeting"),
+		files[2]: filepath.Join("out", "Personal", "meeting_2"),
+		files[3]: filepath.Join("out", "Meeting_2"),
+	} {
+		if got := mirrored[file].base(); got != want {
+			t.Errorf("mirrored %s -> %s, want %s", file, got, want)
+		}
+	}
+
+	flat, err := planOutputs(inputs, "out", true)
+	if err != nil {
+		t.Fatalf("planOutputs failed: %v", err)
+	}
+	// Sorted input order: Meeting_2.note, Personal/Meeting, Personal/meeting, Work/Meeting
+	for file, want := range map[string]string{
+		files[3]: filepath.Join("out", "Meeting_2"),
+		files[1]: filepath.Join("out", "Meeting"),
+		files[2]: filepath.Join("out", "meeting_3"),
+		files[0]: filepath.Join("out", "Meeting_4"),
+	} {
+		if got := flat[file].base(); got != want {
+			t.Errorf("flat %s -> %s, want %s", file, got, want)
+		}
+	}
+
+	if _, err := planOutputs([]noteInput{{path: "elsewhere/x.note", root: in}}, "out", false); err == nil {
+		t.Error("Expected an error for a note outside the input directory")
+	}
+
+	// Files named directly and standard input go to the top of the output
+	direct, err := planOutputs([]noteInput{{path: "elsewhere/x.note"}, {path: stdinPath}}, "out", false)
+	if err != nil {
+		t.Fatalf("planOutputs failed: %v", err)
+	}
+	if direct["elsewhere/x.note"].base() != filepath.Join("out", "x") || direct[stdinPath].base() != filepath.Join("out", "stdin") {
+		t.Errorf("Unexpected outputs %v", direct)
+	}
+}
+
+func TestPageFilesWithNameTemplate(t *testing.T) {
+	f, err := os.Open("../example_notes/example.note")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	nb, err := note.Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := noteOutput{root: "out", rel: filepath.Join("Work", "Meeting")}
+
+	names, err := parseNameTemplate("{dir}/{created}_{note}_p{page1:2}.{ext}", "ignored", false)
+	if err != nil {
+		t.Fatalf("parseNameTemplate failed: %v", err)
+	}
+	files, err := pageFiles(nb, out, "png", time.Time{}, names)
+	if err != nil {
+		t.Fatalf("pageFiles failed: %v", err)
+	}
+	if want := filepath.Join("out", "Work", "2025-08-29_Meeting_p01.png"); len(files) != 1 || files[0] != want {
+		t.Errorf("Expected [%s], got %v", want, files)
+	}
+
+	if _, err := parseNameTemplate("{note}_{page}.{ext}", "", false); err == nil {
+		t.Error("Expected a template without {dir} to be rejected unless flat")
+	}
+	if _, err := parseNameTemplate("{note}_{page}.{ext}", "", true); err != nil {
+		t.Errorf("Expected a template without {dir} to be accepted when flat: %v", err)
+	}
+	if names, _ := parseNameTemplate("", "{dir}/{note}-{pageid}.{ext}", false); names == nil || names.String() != "{dir}/{note}-{pageid}.{ext}" {
+		t.Errorf("Expected the config template to be used, got %v", names)
+	}
+}
+
+func TestPageFileClashesAcrossNotes(t *testing.T) {
+	input, outDir := t.TempDir(), t.TempDir()
+	data, err := os.ReadFile("../example_notes/example.note")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both names become "a_" in file names
+	for _, name := range []string{"a?.note", "a_.note"} {
+		if err := os.WriteFile(filepath.Join(input, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := &runner{
+		paths:   []string{input},
+		outDir:  outDir,
+		workers: 2,
+		opts:    &convertOptions{pool: newPagePool(2), png: converter.NewPNGEncoder(converter.PNGOptions{Compression: png.BestSpeed}), format: formatPNG, layout: layoutPages},
+	}
+	stats, err := r.run(nil)
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if converted, failed := stats.converted.Load(), stats.failed.Load(); converted != 1 || failed != 1 {
+		t.Errorf("Expected the first note converted and the second failed, got %d converted, %d failed", converted, failed)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "a_", "page_000.png")); err != nil {
+		t.Errorf("Expected the first note's page to be written: %v", err)
+	}
+}
+
+func TestNotePageSpecs(t *testing.T) {
+	in := "notes"
+	daily := filepath.Join(in, "Journal", "Daily.note")
+	other := filepath.Join(in, "Work", "Daily.note")
+	plan := filepath.Join(in, "Plan.note")
+	specs, err := notePageSpecs(map[string]string{
+		"Journal/Daily.note": "-7-",
+		"Daily.note":         "0",
+	}, []noteInput{{daily, in}, {other, in}, {plan, in}}, false)
+	if err != nil {
+		t.Fatalf("notePageSpecs failed: %v", err)
+	}
+	if specs[daily].String() != "-7-" || specs[other].String() != "0" || specs[plan] != nil {
+		t.Errorf("Unexpected specs %v", specs)
+	}
+	if _, err := notePageSpecs(map[string]string{"Plan.note": "x"}, []noteInput{{plan, in}}, false); err == nil {
+		t.Error("Expected an invalid spec to be rejected")
+	}
+}
+
+func TestWriteNotebookMarkdownSelectedPages(t *testing.T) {
+	nb := &note.Notebook{FileID: "F1", Pages: []note.PageMeta{{}, {}, {}}}
+	outPath := filepath.Join(t.TempDir(), "n.md")
+	files := []string{"n/page_000.png", "n/page_001.png", "n/page_002.png"}
+	if err := writeNotebookMarkdown(nb, []int{0, 2}, outPath, files, time.Now()); err != nil {
+		t.Fatalf("writeNotebookMarkdown failed: %v", err)
+	}
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := string(data)
+	for _, want := range []string{"![Page 1]", "![Page 3]"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Expected Markdown to contain %q, got:\n%s", want, md)
+		}
+	}
+	if strings.Contains(md, "![Page 2]") {
+		t.Errorf("Page 2 was not selected but is embedded:\n%s", md)
+	}
+}
+
+// annotateNote adds recognized text, a title covering the page and a keyword
+// to the first page of a note, by appending blocks and a new footer.
+func annotateNote(t *testing.T, data []byte, text, keyword string) []byte {
+	t.Helper()
+	block := func(addr int) []byte {
+		n := int(binary.LittleEndian.Uint32(data[addr:]))
+		return data[addr+4 : addr+4+n]
+	}
+	footer := string(block(int(binary.LittleEndian.Uint32(data[len(data)-4:]))))
+	m := regexp.MustCompile(`<PAGE1:(\d+)>`).FindStringSubmatch(footer)
+	if m == nil {
+		t.Fatal("note has no PAGE1")
+	}
+	pageAddr, _ := strconv.Atoi(m[1])
+
+	out := bytes.NewBuffer(append([]byte(nil), data[:len(data)-4]...))
+	add := func(b []byte) int {
+		addr := out.Len()
+		binary.Write(out, binary.LittleEndian, uint32(len(b)))
+		out.Write(b)
+		return addr
+	}
+	recogn := fmt.Sprintf(`{"elements":[{"type":"Text","label":%q,"words":[{"label":%q,"bounding-box":{"x":10,"y":10,"width":20,"height":5}}]}]}`, text, text)
+	recognAddr := add([]byte(base64.StdEncoding.EncodeToString([]byte(recogn))))
+	page := regexp.MustCompile(`<RECOGNTEXT:\d*>`).ReplaceAllString(string(block(pageAddr)), "")
+	newPage := add([]byte(fmt.Sprintf("%s<RECOGNTEXT:%d>", page, recognAddr)))
+	title := add([]byte("<TITLELEVEL:1><TITLERECTORI:0,0,1404,1872>"))
+	kw := add([]byte(fmt.Sprintf("<KEYWORDPAGE:1><KEYWORDSITE:%d>", add([]byte(keyword)))))
+	footer = strings.Replace(footer, m[0], fmt.Sprintf("<PAGE1:%d>", newPage), 1)
+	footer += fmt.Sprintf("<TITLE_00010000000100:%d><KEYWORD_00010000000200:%d>", title, kw)
+	binary.Write(out, binary.LittleEndian, uint32(add([]byte(footer))))
+	return out.Bytes()
+}
+
+func TestBuildSiteNotebooks(t *testing.T) {
+	input, outDir := t.TempDir(), t.TempDir()
+	data, err := os.ReadFile("../example_notes/example.note")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = annotateNote(t, data, "budget", "project x")
+	for _, rel := range []string{"work/example.note", "drafts/example.note"} {
+		os.MkdirAll(filepath.Join(input, filepath.Dir(rel)), 0755)
+		if err := os.WriteFile(filepath.Join(input, rel), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	filter := &noteFilter{exclude: []string{"drafts"}}
+
+	// The second build finds the note unchanged and must describe it all the same
+	for run := 0; run < 2; run++ {
+		notebooks, err := buildSiteNotebooks(newSiteRunner(input, outDir, filter, nil, 2), outDir)
+		if err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+		if len(notebooks) != 1 || notebooks[0].Dir != "work" || len(notebooks[0].Pages) != 1 {
+			t.Fatalf("run %d: unexpected notebooks %+v", run, notebooks)
+		}
+		for _, rel := range []string{notebooks[0].Cover, notebooks[0].Pages[0].Image} {
+			if _, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(rel))); err != nil {
+				t.Errorf("run %d: expected %s to exist: %v", run, rel, err)
+			}
+		}
+		sn := notebooks[0]
+		if sn.Pages[0].Text != "budget" || len(sn.Outline) != 1 || sn.Outline[0].Text != "budget" || len(sn.Keywords) != 1 || sn.Keywords[0] != "project x" {
+			t.Errorf("run %d: expected text, outline and keywords, got %q %+v %q", run, sn.Pages[0].Text, sn.Outline, sn.Keywords)
+		}
+	}
+}
+
+func TestPagePoolBoundsConcurrency(t *testing.T) {
+	pool := newPagePool(3)
+	var mu sync.Mutex
+	running, peak := 0, 0
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go pool.Do(func() {
+			defer wg.Done()
+			mu.Lock()
+			running++
+			if running > peak {
+				peak = running
+			}
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	if peak > 3 {
+		t.Errorf("Expected at most 3 concurrent pages, saw %d", peak)
+	}
+}
+
+// TestExitStatusOnPageFailure runs main in a child process: a page that cannot
+// be written fails its note, and any failed note makes the exit status non-zero.
+func TestExitStatusOnPageFailure(t *testing.T) {
+	if os.Getenv("SUPERNOTE_TOOL_MAIN") == "1" {
+		os.Args = append([]string{"supernote-tool"}, flag.Args()...)
+		main()
+		return
+	}
+	outDir := t.TempDir()
+	// A folder where the page file should go makes the encode stage fail
+	if err := os.MkdirAll(filepath.Join(outDir, "example", "page_000.png"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestExitStatusOnPageFailure$", "--",
+		"-out-dir", outDir, "-log-level", "error", "../example_notes/example.note")
+	cmd.Env = append(os.Environ(), "SUPERNOTE_TOOL_MAIN=1")
+	out, err := cmd.CombinedOutput()
+	var exit *exec.ExitError
+	if !errors.As(err, &exit) || exit.ExitCode() != 1 {
+		t.Fatalf("Expected exit status 1, got %v\n%s", err, out)
+	}
+
+	// The failed page fails the note rather than just being logged
+	opts := &convertOptions{pool: newPagePool(2), png: converter.NewPNGEncoder(converter.PNGOptions{Compression: png.BestSpeed}), stats: &runStats{}}
+	if err := processNoteFile("../example_notes/example.note", noteOutput{root: outDir, rel: "example"}, opts); err == nil {
+		t.Error("Expected processNoteFile to fail when a page fails")
+	}
+	if opts.stats.failed.Load() != 1 || opts.stats.converted.Load() != 0 {
+		t.Errorf("Expected the note to count as failed: %s", opts.stats.summary())
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/merridan/sngo/internal/converter"
+	"github.com/merridan/sngo/internal/logging"
+	"github.com/merridan/sngo/internal/note"
+)
+
+// writeNotebookMarkdown writes <note>.md next to the note's page folder,
+// embedding the page files written by the PNG pipeline.
+func writeNotebookMarkdown(nb *note.Notebook, pages []int, outPath string, files []string, modTime time.Time) error {
+	name := strings.TrimSuffix(filepath.Base(outPath), ".md")
+	file, err := createOutput(outPath)
+	if err != nil {
+		return err
+	}
+	err = converter.WriteMarkdown(file, nb, converter.MarkdownOptions{
+		Name:  name,
+		Pages: pages,
+		PageImage: func(pageNum int) string {
+			rel, err := filepath.Rel(filepath.Dir(outPath), files[pageNum])
+			if err != nil {
+				return files[pageNum]
+			}
+			return filepath.ToSlash(rel)
+		},
+		Modified: modTime,
+	})
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("write %s: %w", outPath, err)
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	setModTime(outPath, modTime)
+	logging.Info("wrote %s", outPath)
+	return nil
+}
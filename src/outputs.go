@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/merridan/sngo/internal/converter"
+	"github.com/merridan/sngo/internal/logging"
+	"github.com/merridan/sngo/internal/note"
+)
+
+// noteOutput is where a note's output goes: rel is the note's path under the
+// output root without extension, e.g. Work/Meeting.
+type noteOutput struct {
+	root string
+	rel  string
+}
+
+// base is the stem single-file formats (.tiff, .epub, .md) add an extension to.
+func (o noteOutput) base() string { return filepath.Join(o.root, o.rel) }
+
+// pageName returns the name template values shared by every page of the note.
+func (o noteOutput) pageName() converter.PageName {
+	dir, name := path.Split(filepath.ToSlash(o.rel))
+	return converter.PageName{Dir: strings.TrimSuffix(dir, "/"), Note: name}
+}
+
+// planOutputs decides where each note is written before any work starts.
+//
+// By default the output mirrors the note's path under the directory it was
+// found in, so Work/Meeting.note and Personal/Meeting.note land in
+// Work/Meeting and Personal/Meeting; notes named directly on the command line
+// go to the top of outDir, and standard input is named "stdin". With flat set
+// every note goes directly into outDir. Names that would still clash (same
+// name in flat mode, or names differing only in case, which share a folder on
+// case-insensitive file systems) get a _2, _3, ... suffix in sorted input
+// order, so reruns pick the same names.
+func planOutputs(inputs []noteInput, outDir string, flat bool) (map[string]noteOutput, error) {
+	sorted := append([]noteInput(nil), inputs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].path < sorted[j].path })
+
+	outputs := make(map[string]noteOutput, len(sorted))
+	owner := map[string]string{} // lower-cased rel -> note that claimed it
+	var clashes []string
+	for _, in := range sorted {
+		noteFile := in.path
+		rel := filepath.Base(noteFile)
+		switch {
+		case noteFile == stdinPath:
+			rel = "stdin"
+		case !flat && in.root != "":
+			var err error
+			if rel, err = filepath.Rel(in.root, noteFile); err != nil || strings.HasPrefix(rel, "..") {
+				return nil, fmt.Errorf("%s is outside the input directory %s", noteFile, in.root)
+			}
+		}
+		rel = strings.TrimSuffix(rel, filepath.Ext(rel))
+		outputs[noteFile] = noteOutput{root: outDir, rel: rel}
+		if _, taken := owner[strings.ToLower(rel)]; taken {
+			clashes = append(clashes, noteFile)
+			continue
+		}
+		owner[strings.ToLower(rel)] = noteFile
+	}
+
+	// Suffixes are handed out after every natural name is claimed, so a
+	// renamed clash never takes the name of another note (e.g. a real "Meeting_2").
+	for _, noteFile := range clashes {
+		natural := outputs[noteFile].rel
+		rel := natural
+		for n := 2; ; n++ {
+			rel = fmt.Sprintf("%s_%d", natural, n)
+			if _, taken := owner[strings.ToLower(rel)]; !taken {
+				break
+			}
+		}
+		logging.Warn("%s and %s both map to %s; writing %s instead",
+			owner[strings.ToLower(natural)], noteFile, filepath.Join(outDir, natural), filepath.Join(outDir, rel))
+		owner[strings.ToLower(rel)] = noteFile
+		outputs[noteFile] = noteOutput{root: outDir, rel: rel}
+	}
+	return outputs, nil
+}
+
+// parseNameTemplate picks the -name-template flag, else the config key, else
+// the default. Unless flat is set the template must contain {dir}: without it,
+// notes with the same name in different folders would write the same files.
+func parseNameTemplate(flagValue, configValue string, flat bool) (*converter.NameTemplate, error) {
+	text := converter.DefaultNameTemplate
+	switch {
+	case flagValue != "":
+		text = flagValue
+	case configValue != "":
+		text = configValue
+	}
+	names, err := converter.ParseNameTemplate(text)
+	if err != nil {
+		return nil, err
+	}
+	if !flat && !names.Uses("dir") {
+		return nil, fmt.Errorf("name template %q must contain {dir} unless -flat is set, or notes with the same name in different folders would share files", text)
+	}
+	return names, nil
+}
+
+// pageFiles expands the name template for every page of nb. Two pages
+// mapping to the same file (e.g. a {pageid} template on a note with
+// duplicated page ids) is an error, reported before anything is written.
+func pageFiles(nb *note.Notebook, out noteOutput, ext string, modTime time.Time, names *converter.NameTemplate) ([]string, error) {
+	n := out.pageName()
+	n.Ext = ext
+	n.Created = nb.FileID.CreatedAt()
+	if n.Created.IsZero() {
+		n.Created = modTime
+	}
+	var titles []string
+	if names.Uses("title") {
+		titles = pageTitles(nb, n.Note)
+	}
+
+	files := make([]string, len(nb.Pages))
+	seen := map[string]int{}
+	for pageNum, page := range nb.Pages {
+		n.Page = pageNum
+		n.PageID = page.Params["PAGEID"]
+		if titles != nil {
+			n.Title = titles[pageNum]
+		}
+		rel := names.Expand(n)
+		if prev, dup := seen[strings.ToLower(rel)]; dup {
+			return nil, fmt.Errorf("name template %q gives pages %d and %d the same name %s", names, prev, pageNum, rel)
+		}
+		seen[strings.ToLower(rel)] = pageNum
+		files[pageNum] = filepath.Join(out.root, filepath.FromSlash(rel))
+	}
+	return files, nil
+}
+
+// pageFileClashes expands the name template for the selected pages of every
+// note and returns the notes that would write a file another note writes:
+// values made safe for file names can coincide ("a?" and "a_"), and so can
+// templates without separators ("{note}{page}"). Files are compared
+// case-insensitively, as in planOutputs, and the note first in sorted order
+// keeps the file. Notes that do not open are left to fail when converted.
+func pageFileClashes(inputs []noteInput, outputs map[string]noteOutput, opts *convertOptions) map[string]error {
+	clashes := map[string]error{}
+	if opts.stdout || !opts.writesPageFiles() {
+		return clashes
+	}
+	var noteFiles []string
+	for _, in := range inputs {
+		// Standard input can only be read once, by its conversion
+		if in.path != stdinPath {
+			noteFiles = append(noteFiles, in.path)
+		}
+	}
+	sort.Strings(noteFiles)
+
+	owner := map[string]string{} // lower-cased page file -> note writing it
+	for _, noteFile := range noteFiles {
+		nb, modTime, closer, err := openNote(noteFile)
+		if err != nil {
+			continue
+		}
+		pages, err := opts.selectPages(noteFile, nb)
+		var files []string
+		if err == nil {
+			files, err = pageFiles(nb, outputs[noteFile], opts.pageExt(), modTime, opts.pageNames())
+		}
+		closer.Close()
+		if err != nil {
+			continue
+		}
+		for _, pageNum := range pages {
+			if other, taken := owner[strings.ToLower(files[pageNum])]; taken {
+				clashes[noteFile] = fmt.Errorf("name template %q gives page %d the file %s, which %s writes too", opts.pageNames(), pageNum, files[pageNum], other)
+				break
+			}
+		}
+		if clashes[noteFile] != nil {
+			continue
+		}
+		for _, pageNum := range pages {
+			owner[strings.ToLower(files[pageNum])] = noteFile
+		}
+	}
+	return clashes
+}
+
+// pageTitles returns the text of the first title on each page ("" if none).
+func pageTitles(nb *note.Notebook, name string) []string {
+	titles := make([]string, len(nb.Pages))
+	outline, _ := converter.Outline(nb, name)
+	for i := len(outline) - 1; i >= 0; i-- {
+		titles[outline[i].Page] = outline[i].Text
+	}
+	return titles
+}
+
+// stdoutPath stands for standard output in place of an output file (-stdout)
+const stdoutPath = "-"
+
+// createOutput creates an output file, or returns standard output for stdoutPath.
+func createOutput(path string) (io.WriteCloser, error) {
+	if path == stdoutPath {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	return os.Create(path)
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// setModTime gives an output file the note's modification time
+func setModTime(path string, modTime time.Time) {
+	if path == stdoutPath {
+		return
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		logging.Warn("failed to set mtime on %s: %v", path, err)
+	}
+}
+
+// makeParentDirs creates the folders files go into and returns them.
+func makeParentDirs(files []string) ([]string, error) {
+	var dirs []string
+	seen := map[string]bool{}
+	for _, f := range files {
+		dir := filepath.Dir(f)
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory %s: %v", dir, err)
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs, nil
+}
+
+// touchNoteDirs gives folders the note's modification time once its pages are
+// written, if the template puts every note in folders of its own; folders
+// shared with other notes are left alone.
+func touchNoteDirs(dirs []string, modTime time.Time, names *converter.NameTemplate) {
+	if !names.NoteFolders() {
+		return
+	}
+	for _, dir := range dirs {
+		if err := os.Chtimes(dir, modTime, modTime); err != nil {
+			logging.Warn("failed to set mtime on %s: %v", dir, err)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"sync"
+	"time"
+
+	"github.com/merridan/sngo/internal/converter"
+	"github.com/merridan/sngo/internal/logging"
+	"github.com/merridan/sngo/internal/note"
+	"github.com/merridan/sngo/internal/state"
+)
+
+// convertOptions carries flag-derived settings through the conversion pipeline
+type convertOptions struct {
+	pool    *pagePool
+	png     *converter.PNGEncoder
+	inkOnly bool    // skip the background layer and keep untouched paper transparent
+	scale   float64 // output scale relative to the device raster (0 or 1 = native)
+	dpi     int     // output resolution; overrides scale when set
+	format  string  // output format, one of the format* constants
+	replay  converter.ReplayOptions
+	layout  string // page layout for PNG output, one of the layout* constants
+	sheet   converter.SheetOptions
+	names   *converter.NameTemplate // page file names; nil means converter.DefaultNameTemplate
+
+	pages     *converter.PageSpec            // -pages; nil converts every page
+	notePages map[string]*converter.PageSpec // per-note overrides from config.json, by note file
+
+	stdout bool // write the single output file to standard output
+
+	state *state.State // outputs of earlier runs; nil converts everything
+	force bool         // ignore the state and rebuild every note
+	stats *runStats
+
+	// noteDone, if set, is called once a note's page files are written, with
+	// the open note, the selected pages and every page's file. For a note
+	// skipped as unchanged it is called with only inputPath and out.
+	noteDone func(inputPath string, out noteOutput, nb *note.Notebook, pages []int, files []string)
+}
+
+// Output formats selected with -format
+const (
+	formatPNG      = "png"
+	formatGIF      = "gif"      // animated stroke replay per page
+	formatFrames   = "frames"   // stroke replay as numbered PNG frames per page
+	formatTIFF     = "tiff"     // one multi-page TIFF per notebook
+	formatMarkdown = "markdown" // PNG pages plus a <note>.md for Markdown vaults
+	formatEPUB     = "epub"     // one fixed-layout EPUB per notebook
+)
+
+// scaleFor returns the render scale for a notebook (1 = device raster)
+func (o *convertOptions) scaleFor(nb *note.Notebook) float64 {
+	if o.dpi > 0 {
+		return converter.ScaleForDPI(nb, o.dpi)
+	}
+	if o.scale > 0 {
+		return o.scale
+	}
+	return 1
+}
+
+// selectPages returns the 0-based pages of a note to convert
+func (o *convertOptions) selectPages(inputPath string, nb *note.Notebook) ([]int, error) {
+	spec := o.pages
+	if s, ok := o.notePages[inputPath]; ok {
+		spec = s
+	}
+	if spec == nil {
+		spec, _ = converter.ParsePageSpec("", false)
+	}
+	pages, err := spec.Pages(len(nb.Pages))
+	if err != nil {
+		return nil, fmt.Errorf("pages %q: %w", spec, err)
+	}
+	if len(pages) < len(nb.Pages) {
+		logging.Debug("%s: converting %d of %d pages", inputPath, len(pages), len(nb.Pages))
+	}
+	return pages, nil
+}
+
+// pageNames returns the name template for page files
+func (o *convertOptions) pageNames() *converter.NameTemplate {
+	if o.names != nil {
+		return o.names
+	}
+	t, err := converter.ParseNameTemplate(converter.DefaultNameTemplate)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// pageExt is the extension of page files
+func (o *convertOptions) pageExt() string {
+	if o.format == formatGIF {
+		return "gif"
+	}
+	return "png"
+}
+
+// writesPageFiles reports whether notes are written as one file (or frame
+// folder) per page named by the template, rather than as a single file.
+func (o *convertOptions) writesPageFiles() bool {
+	return o.format != formatTIFF && o.format != formatEPUB && o.layout != layoutScroll && o.layout != layoutGrid
+}
+
+// pageWork is a page travelling through the decode -> post-process -> encode stages
+type pageWork struct {
+	pageNum int
+	main    *note.GrayImage
+	bg      *note.GrayImage
+	img     image.Image
+	err     error
+}
+
+// stageTimes accumulates time spent per stage across all pages of a note
+type stageTimes struct {
+	mu                   sync.Mutex
+	decode, post, encode time.Duration
+}
+
+func (st *stageTimes) add(d *time.Duration, since time.Time) {
+	elapsed := time.Since(since)
+	st.mu.Lock()
+	*d += elapsed
+	st.mu.Unlock()
+}
+
+// processNoteFile processes a single .note file for PNG generation (all pages),
+// writing to out (see planOutputs) under the names of opts.names.
+// Pages flow through decode, post-process and encode stages connected by
+// bounded channels; decode and encode work runs on the shared page pool.
+//
+// With a state file, notes whose content, settings and outputs are unchanged
+// since the previous run are skipped, and unchanged pages are not re-encoded.
+func processNoteFile(inputPath string, out noteOutput, opts *convertOptions) error {
+	start := time.Now()
+	stats := opts.stats
+	if stats == nil {
+		stats = &runStats{}
+	}
+	rec, unchanged, err := checkNote(inputPath, out, opts)
+	if err != nil {
+		stats.failed.Add(1)
+		return err
+	}
+	if unchanged {
+		logging.Info("%s is unchanged, skipping", inputPath)
+		stats.unchanged.Add(1)
+		if opts.noteDone != nil {
+			opts.noteDone(inputPath, out, nil, nil, nil)
+		}
+		return nil
+	}
+	if err := convertNote(inputPath, out, rec, opts, start); err != nil {
+		stats.failed.Add(1)
+		rec.saveFailed(opts.state)
+		return err
+	}
+	rec.save(opts.state)
+	stats.converted.Add(1)
+	return nil
+}
+
+// convertNote parses a note and writes its outputs, recording them in rec.
+func convertNote(inputPath string, out noteOutput, rec *noteRecord, opts *convertOptions, start time.Time) error {
+	// Outputs carry the note's modification time so they sort chronologically downstream
+	nb, modTime, closer, err := openNote(inputPath)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+	logging.Debug("%s: file id %s created %s", inputPath, nb.FileID, nb.FileID.CreatedAt().Format(time.RFC3339))
+	rec.start(nb)
+	pages, err := opts.selectPages(inputPath, nb)
+	if err != nil {
+		return err
+	}
+	if len(pages) == 0 {
+		logging.Info("%s: no pages selected", inputPath)
+		return nil
+	}
+
+	// Single-file formats are written next to where the page folder would be
+	single := func(suffix string) string {
+		if opts.stdout {
+			return stdoutPath
+		}
+		return out.base() + suffix
+	}
+	var outPath string
+	switch {
+	case opts.format == formatTIFF:
+		outPath = single(".tiff")
+		err = writeNotebookTIFF(nb, pages, outPath, modTime, opts)
+	case opts.format == formatEPUB:
+		outPath = single(".epub")
+		err = writeNotebookEPUB(nb, pages, outPath, modTime, opts)
+	case opts.layout == layoutScroll || opts.layout == layoutGrid:
+		outPath = single("_" + opts.layout + ".png")
+		err = writeNotebookSheet(nb, pages, outPath, modTime, opts)
+	default:
+		return convertPageFiles(nb, inputPath, pages, out, modTime, rec, opts, start)
+	}
+	if err != nil {
+		return err
+	}
+	rec.file(outPath)
+	opts.stats.addPages(0, len(pages))
+	return nil
+}
+
+// convertPageFiles writes one file (or frame folder) per selected page, plus
+// the Markdown file for -format markdown.
+func convertPageFiles(nb *note.Notebook, inputPath string, pages []int, out noteOutput, modTime time.Time, rec *noteRecord, opts *convertOptions, start time.Time) error {
+	files, err := pageFiles(nb, out, opts.pageExt(), modTime, opts.pageNames())
+	if err != nil {
+		return err
+	}
+	if opts.stdout {
+		if len(pages) != 1 {
+			return fmt.Errorf("-stdout takes a single page, but %d are selected (use -pages)", len(pages))
+		}
+		files[pages[0]] = stdoutPath
+		return convertPages(nb, inputPath, pages, files, modTime, rec, opts, start)
+	}
+	var selected []string
+	for _, pageNum := range pages {
+		selected = append(selected, files[pageNum])
+	}
+	dirs, err := makeParentDirs(selected)
+	if err != nil {
+		return err
+	}
+	defer touchNoteDirs(dirs, modTime, opts.pageNames())
+	if err := convertPages(nb, inputPath, pages, files, modTime, rec, opts, start); err != nil {
+		return err
+	}
+	if opts.format == formatMarkdown {
+		if err := writeNotebookMarkdown(nb, pages, out.base()+".md", files, modTime); err != nil {
+			return err
+		}
+		rec.file(out.base() + ".md")
+	}
+	if opts.noteDone != nil {
+		opts.noteDone(inputPath, out, nb, pages, files)
+	}
+	return nil
+}
+
+// convertPages writes the selected pages to their files. Pages whose content
+// hash matches the file rec has from the previous run are neither decoded nor
+// encoded. A page that fails is logged and the others are still written, but
+// the note then fails as a whole.
+func convertPages(nb *note.Notebook, inputPath string, pages []int, files []string, modTime time.Time, rec *noteRecord, opts *convertOptions, start time.Time) error {
+	outputs := files
+	if opts.format == formatFrames {
+		outputs = frameDirs(files)
+	}
+	pages = reusePages(nb, pages, outputs, rec, opts.stats)
+	if opts.format == formatGIF || opts.format == formatFrames {
+		return writeReplays(nb, inputPath, pages, files, modTime, rec, opts)
+	}
+
+	scale := opts.scaleFor(nb)
+	var times stageTimes
+	workers := cap(opts.pool.slots)
+	pageNums := make(chan int)
+	decoded := make(chan *pageWork, workers)
+	processed := make(chan *pageWork, workers)
+	pageErrs := make([]error, len(nb.Pages))
+
+	go func() {
+		for _, pageNum := range pages {
+			pageNums <- pageNum
+		}
+		close(pageNums)
+	}()
+
+	// Decode stage
+	var decodeWG sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		decodeWG.Add(1)
+		go func() {
+			defer decodeWG.Done()
+			for pageNum := range pageNums {
+				pw := &pageWork{pageNum: pageNum}
+				opts.pool.Do(func() {
+					defer times.add(&times.decode, time.Now())
+					switch {
+					case scale != 1:
+						pw.main, pw.bg, pw.err = converter.DecodeLayersScaled(nb, pageNum, scale, !opts.inkOnly)
+					case opts.inkOnly:
+						pw.main, pw.err = nb.DecodeMainLayer(pageNum)
+					default:
+						pw.main, pw.bg, pw.err = nb.DecodeLayers(pageNum)
+					}
+				})
+				decoded <- pw
+			}
+		}()
+	}
+	go func() {
+		decodeWG.Wait()
+		close(decoded)
+	}()
+
+	// Post-process stage: composite the background under the main layer
+	go func() {
+		for pw := range decoded {
+			if pw.err == nil {
+				t := time.Now()
+				postProcess(pw)
+				times.add(&times.post, t)
+			}
+			processed <- pw
+		}
+		close(processed)
+	}()
+
+	// Encode stage
+	var encodeWG sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		encodeWG.Add(1)
+		go func() {
+			defer encodeWG.Done()
+			for pw := range processed {
+				if pw.err != nil {
+					pageErrs[pw.pageNum] = fmt.Errorf("decode: %w", pw.err)
+					continue
+				}
+				opts.pool.Do(func() {
+					defer times.add(&times.encode, time.Now())
+					pageErrs[pw.pageNum] = savePage(pw, files[pw.pageNum], modTime, opts)
+				})
+			}
+		}()
+	}
+	encodeWG.Wait()
+
+	// Report in page order
+	failed := 0
+	for _, pageNum := range pages {
+		if err := pageErrs[pageNum]; err != nil {
+			logging.Error("failed to process page %d in %s: %v", pageNum, inputPath, err)
+			failed++
+			continue
+		}
+		rec.page(pageNum, files[pageNum], nb.Pages[pageNum].Hash)
+		opts.stats.addPages(0, 1)
+		logging.Info("wrote %s", files[pageNum])
+	}
+	logging.Debug("%s: %d pages in %v (decode %v, post-process %v, encode %v)",
+		inputPath, len(pages), time.Since(start).Round(time.Millisecond),
+		times.decode.Round(time.Millisecond), times.post.Round(time.Millisecond), times.encode.Round(time.Millisecond))
+	if failed > 0 {
+		return fmt.Errorf("%d of %d page(s) failed", failed, len(pages))
+	}
+	return nil
+}
+
+// postProcess turns decoded layers into the final page image
+func postProcess(pw *pageWork) {
+	if pw.bg != nil {
+		note.Composite(pw.main, pw.bg)
+		pw.bg.Release()
+		pw.bg = nil
+	}
+	pw.img = pw.main
+}
+
+// savePage encodes and writes a post-processed page, then returns its buffers to the pool
+func savePage(pw *pageWork, outPath string, modTime time.Time, opts *convertOptions) error {
+	defer releaseImage(pw.img)
+	file, err := createOutput(outPath)
+	if err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+	if err := opts.png.Encode(file, pw.img); err != nil {
+		file.Close()
+		return fmt.Errorf("save: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+	setModTime(outPath, modTime)
+	return nil
+}
+
+// releaseImage returns pooled page buffers once an image has been written
+func releaseImage(img image.Image) {
+	if g, ok := img.(*note.GrayImage); ok {
+		g.Release()
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/merridan/sngo/internal/logging"
+	"github.com/merridan/sngo/internal/state"
+)
+
+// pruneOutputs removes outputs that the current inputs no longer produce:
+// pages deleted from a note, notes deleted or no longer selected, and the
+// outputs of earlier settings. Only files in the state's manifest are touched,
+// so anything else in the output tree is left alone; folders are removed once
+// pruning leaves them empty. With dryRun set it only lists what it would
+// remove. It returns the number of outputs (to be) removed.
+func pruneOutputs(inputs []noteInput, st *state.State, outDir string, dryRun bool) int {
+	current := map[string]bool{}
+	keep := map[string]bool{}
+	for _, in := range inputs {
+		key, err := filepath.Abs(in.path)
+		if err != nil {
+			continue
+		}
+		current[key] = true
+		// A note that failed this run keeps its record, and with it its outputs
+		if n := st.Note(key); n != nil {
+			for _, f := range n.Files {
+				keep[f] = true
+			}
+		}
+	}
+
+	pruned := 0
+	for _, f := range st.Manifest() {
+		if keep[f] {
+			continue
+		}
+		path := filepath.Join(outDir, filepath.FromSlash(f))
+		if dryRun {
+			if _, err := os.Lstat(path); err == nil {
+				logging.Info("would remove %s", path)
+				pruned++
+			}
+			continue
+		}
+		removed, err := removeOutput(path)
+		if err != nil {
+			logging.Warn("failed to remove %s: %v", path, err)
+			continue
+		}
+		st.Untrack(f)
+		if removed {
+			logging.Info("removed %s", path)
+			removeEmptyDirs(outDir, filepath.Dir(path))
+			pruned++
+		}
+	}
+
+	// Records of notes that are gone are dropped only now: until a run
+	// prunes, a renamed note is still recognized by its old record.
+	for _, key := range st.Paths() {
+		if !current[key] && !dryRun {
+			st.DeleteNote(key)
+		}
+	}
+	return pruned
+}
+
+// removeOutput removes an output file, or a frame folder with the frames in
+// it. It reports false if the output was already gone.
+func removeOutput(path string) (bool, error) {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !info.IsDir() {
+		return true, os.Remove(path)
+	}
+	if err := removeFrames(path); err != nil {
+		return false, err
+	}
+	// Anything else in the folder was not made by the tool, so the folder stays
+	if err := os.Remove(path); err != nil {
+		logging.Warn("%s holds files the tool did not create; removed only its frames", path)
+	}
+	return true, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/merridan/sngo/internal/state"
+)
+
+func TestPruneOutputs(t *testing.T) {
+	outDir := t.TempDir()
+	for _, f := range []string{
+		"a/page_000.png",
+		"a/page_001.png", // page deleted from a.note
+		"b/page_000.png", // b.note deleted
+		"a/notes.txt",    // the user's own file
+		"c/page_000/frame_0000.png",
+		"c/page_000/mine.txt",
+	} {
+		p := filepath.Join(outDir, filepath.FromSlash(f))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st, err := state.Load(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aKey, _ := filepath.Abs("a.note")
+	bKey, _ := filepath.Abs("b.note")
+	st.SetNote(aKey, &state.Note{Files: []string{"a/page_000.png"}})
+	st.SetNote(bKey, &state.Note{Files: []string{"b/page_000.png"}})
+	st.Track("a/page_000.png", "a/page_001.png", "b/page_000.png", "c/page_000")
+	inputs := []noteInput{{path: "a.note"}}
+
+	if n := pruneOutputs(inputs, st, outDir, true); n != 3 {
+		t.Errorf("Expected a dry run to list 3 outputs, got %d", n)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "b", "page_000.png")); err != nil {
+		t.Errorf("Expected a dry run to remove nothing: %v", err)
+	}
+
+	if n := pruneOutputs(inputs, st, outDir, false); n != 3 {
+		t.Errorf("Expected 3 outputs pruned, got %d", n)
+	}
+	for f, want := range map[string]bool{
+		"a/page_000.png":            true,
+		"a/page_001.png":            false,
+		"a/notes.txt":               true,
+		"b":                         false,
+		"c/page_000/frame_0000.png": false,
+		"c/page_000/mine.txt":       true,
+	} {
+		_, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(f)))
+		if exists := err == nil; exists != want {
+			t.Errorf("%s: exists = %v, want %v", f, exists, want)
+		}
+	}
+	if got := st.Manifest(); len(got) != 1 || got[0] != "a/page_000.png" {
+		t.Errorf("Expected only the kept output in the manifest, got %q", got)
+	}
+	if st.Note(bKey) != nil {
+		t.Error("Expected the deleted note's record to be dropped")
+	}
+}
+
+func TestDryRunWritesNothing(t *testing.T) {
+	outDir := t.TempDir()
+	r := &runner{
+		paths:   []string{"../example_notes/example.note"},
+		outDir:  outDir,
+		workers: 1,
+		prune:   true,
+		dryRun:  true,
+		opts:    &convertOptions{pool: newPagePool(1), format: formatPNG, layout: layoutPages, state: loadState(outDir)},
+	}
+	if _, err := r.run(nil); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	entries, err := os.ReadDir(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected a dry run to leave %s empty, found %d entries", outDir, len(entries))
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/merridan/sngo/internal/logging"
+	"github.com/merridan/sngo/internal/note"
+	"github.com/merridan/sngo/internal/state"
+)
+
+// trackRenames finds notes renamed or moved since the previous run and moves
+// their outputs along, so they are not converted again under the new name
+// while the old outputs linger. A note counts as moved when its recorded file
+// is gone and a note without a record has the same FILE_ID, which the device
+// keeps across renames. Each move is added to the note's rename history.
+func trackRenames(inputs []noteInput, outputs map[string]noteOutput, opts *convertOptions) {
+	st := opts.state
+	if st == nil || opts.force {
+		return
+	}
+	gone := map[note.FileID][]string{} // records of missing notes, by FILE_ID
+	for _, key := range st.Paths() {
+		if _, err := os.Stat(key); !os.IsNotExist(err) {
+			continue
+		}
+		if id := note.FileID(st.Note(key).FileID); id != "" {
+			gone[id] = append(gone[id], key)
+		}
+	}
+	if len(gone) == 0 {
+		return
+	}
+
+	for _, in := range inputs {
+		if in.path == stdinPath {
+			continue
+		}
+		key, err := filepath.Abs(in.path)
+		if err != nil || st.Note(key) != nil {
+			continue
+		}
+		// Parse errors are reported when the note is converted
+		nb, modTime, closer, err := openNote(in.path)
+		if err != nil {
+			continue
+		}
+		if oldKeys := gone[nb.FileID]; len(oldKeys) > 0 {
+			gone[nb.FileID] = oldKeys[1:]
+			if err := moveOutputs(nb, modTime, oldKeys[0], key, in.path, outputs[in.path], opts); err != nil {
+				logging.Warn("%s was %s, but its outputs could not be moved: %v", in.path, oldKeys[0], err)
+			}
+		}
+		closer.Close()
+	}
+}
+
+// moveOutputs moves the outputs recorded for the note at oldKey to where the
+// note at newKey writes them, and moves the record over.
+func moveOutputs(nb *note.Notebook, modTime time.Time, oldKey, newKey, inputPath string, out noteOutput, opts *convertOptions) error {
+	st := opts.state
+	prev := st.Note(oldKey)
+	moved := *prev
+	moved.Output = filepath.ToSlash(out.rel)
+	moved.Settings = opts.settings(inputPath, out)
+	moved.Renames = append(append([]state.Rename(nil), prev.Renames...), state.Rename{From: oldKey, To: newKey, At: time.Now()})
+	if prev.Output == "" || prev.Settings != opts.settings(inputPath, noteOutput{root: out.root, rel: filepath.FromSlash(prev.Output)}) {
+		// Outputs made with other settings would be rebuilt anyway
+		moved.Hash, moved.Files, moved.Pages = "", nil, nil
+		st.DeleteNote(oldKey)
+		st.SetNote(newKey, &moved)
+		logging.Info("%s was renamed to %s; settings changed, converting it again", oldKey, inputPath)
+		return nil
+	}
+
+	// Page files are renamed page by page, since the name template may put
+	// the note name anywhere; other outputs are named after the note.
+	rel := func(path string) string {
+		r, _ := filepath.Rel(out.root, path)
+		return filepath.ToSlash(r)
+	}
+	renames := map[string]string{}
+	if hasPageFiles(prev) {
+		files, err := pageFiles(nb, out, opts.pageExt(), modTime, opts.pageNames())
+		if err != nil {
+			return err
+		}
+		if opts.format == formatFrames {
+			files = frameDirs(files)
+		}
+		moved.Pages = append([]state.Page(nil), prev.Pages[:min(len(prev.Pages), len(nb.Pages))]...)
+		for i, p := range moved.Pages {
+			if p.File != "" {
+				renames[p.File] = rel(files[i])
+				moved.Pages[i].File = rel(files[i])
+			}
+		}
+	}
+	moved.Files = nil
+	for _, f := range prev.Files {
+		to, ok := renames[f]
+		if !ok {
+			suffix, found := strings.CutPrefix(f, prev.Output)
+			if !found {
+				continue
+			}
+			to = moved.Output + suffix
+			renames[f] = to
+		}
+		moved.Files = append(moved.Files, to)
+	}
+
+	// Once anything has moved the record must follow, so on failure it is
+	// kept without a content hash: the note is converted again, reusing what moved.
+	st.DeleteNote(oldKey)
+	defer st.SetNote(newKey, &moved)
+	froms := make([]string, 0, len(renames))
+	for from := range renames {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+	for _, from := range froms {
+		src := filepath.Join(out.root, filepath.FromSlash(from))
+		dst := filepath.Join(out.root, filepath.FromSlash(renames[from]))
+		if err := moveFile(src, dst); err != nil {
+			moved.Hash = ""
+			return err
+		}
+		st.Untrack(from)
+		st.Track(renames[from])
+		removeEmptyDirs(out.root, filepath.Dir(src))
+	}
+	logging.Info("%s was renamed to %s; moved %d output(s)", oldKey, inputPath, len(froms))
+	if opts.format == formatMarkdown || opts.format == formatEPUB {
+		// The .md links to the page files and the book title is the note's
+		// name, so those are written again; the moved pages are reused.
+		moved.Hash = ""
+	}
+	return nil
+}
+
+func hasPageFiles(n *state.Note) bool {
+	for _, p := range n.Pages {
+		if p.File != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// moveFile renames a file or folder, creating the destination's folder. It
+// never replaces an existing file.
+func moveFile(src, dst string) error {
+	if src == dst {
+		return nil
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("%s already exists", dst)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.Rename(src, dst)
+}
+
+// removeEmptyDirs removes dir and its parents up to root while they are empty.
+func removeEmptyDirs(root, dir string) {
+	root = filepath.Clean(root) + string(filepath.Separator)
+	for dir = filepath.Clean(dir); strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		logging.Debug("removed empty folder %s", dir)
+	}
+}
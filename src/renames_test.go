@@ -0,0 +1,81 @@
+package main
+
+import (
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/merridan/sngo/internal/converter"
+	"github.com/merridan/sngo/internal/state"
+)
+
+func TestTrackRenames(t *testing.T) {
+	inDir, outDir := t.TempDir(), t.TempDir()
+	data, err := os.ReadFile("../example_notes/example.note")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPath := filepath.Join(inDir, "Meeting.note")
+	if err := os.WriteFile(oldPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	run := func() *convertOptions {
+		t.Helper()
+		st, err := state.Load(outDir)
+		if err != nil {
+			t.Fatalf("state.Load failed: %v", err)
+		}
+		opts := &convertOptions{
+			pool:  newPagePool(2),
+			png:   converter.NewPNGEncoder(converter.PNGOptions{Compression: png.BestSpeed}),
+			state: st,
+			stats: &runStats{},
+		}
+		inputs, err := collectInputs([]string{inDir}, nil)
+		if err != nil {
+			t.Fatalf("collectInputs failed: %v", err)
+		}
+		outputs, err := planOutputs(inputs, outDir, false)
+		if err != nil {
+			t.Fatalf("planOutputs failed: %v", err)
+		}
+		trackRenames(inputs, outputs, opts)
+		for _, in := range inputs {
+			if err := processNoteFile(in.path, outputs[in.path], opts); err != nil {
+				t.Fatalf("processNoteFile failed: %v", err)
+			}
+		}
+		if err := st.Save(); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+		return opts
+	}
+	run()
+
+	// Rename and move the note on the "device"
+	newPath := filepath.Join(inDir, "Archive", "Standup.note")
+	os.MkdirAll(filepath.Dir(newPath), 0755)
+	if err := os.Rename(oldPath, newPath); err != nil {
+		t.Fatal(err)
+	}
+	opts := run()
+
+	if opts.stats.unchanged.Load() != 1 {
+		t.Errorf("Expected the moved note not to be converted again: %s", opts.stats.summary())
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "Archive", "Standup", "page_000.png")); err != nil {
+		t.Errorf("Expected the page to be moved: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "Meeting")); !os.IsNotExist(err) {
+		t.Errorf("Expected the old output folder to be gone, got %v", err)
+	}
+	newKey, _ := filepath.Abs(newPath)
+	rec := opts.state.Note(newKey)
+	if rec == nil || len(rec.Renames) != 1 {
+		t.Fatalf("Expected one rename in the record, got %+v", rec)
+	}
+	if oldKey, _ := filepath.Abs(oldPath); rec.Renames[0].From != oldKey || opts.state.Note(oldKey) != nil {
+		t.Errorf("Expected the record to move from %s, got %+v", oldKey, rec.Renames[0])
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/merridan/sngo/internal/converter"
+	"github.com/merridan/sngo/internal/logging"
+	"github.com/merridan/sngo/internal/note"
+)
+
+// writeReplays renders each page as a stroke replay: one animated GIF per page
+// for -format gif, or a folder of numbered PNG frames for -format frames, named
+// after the page's file without extension.
+func writeReplays(nb *note.Notebook, inputPath string, pages []int, files []string, modTime time.Time, rec *noteRecord, opts *convertOptions) error {
+	ropts := opts.replay
+	ropts.Scale = opts.scaleFor(nb)
+	ropts.Background = !opts.inkOnly
+
+	pageErrs := make([]error, len(nb.Pages))
+	outPaths := make([]string, len(nb.Pages))
+	var wg sync.WaitGroup
+	for _, pageNum := range pages {
+		wg.Add(1)
+		go func(pageNum int) {
+			defer wg.Done()
+			opts.pool.Do(func() {
+				if opts.format == formatGIF {
+					outPaths[pageNum] = files[pageNum]
+					pageErrs[pageNum] = saveReplayGIF(nb, pageNum, outPaths[pageNum], ropts)
+				} else {
+					outPaths[pageNum] = frameDir(files[pageNum])
+					pageErrs[pageNum] = saveReplayFrames(nb, pageNum, outPaths[pageNum], ropts, opts.png)
+				}
+				if pageErrs[pageNum] == nil {
+					setModTime(outPaths[pageNum], modTime)
+				}
+			})
+		}(pageNum)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, pageNum := range pages {
+		if err := pageErrs[pageNum]; err != nil {
+			logging.Error("failed to replay page %d in %s: %v", pageNum, inputPath, err)
+			failed++
+			continue
+		}
+		rec.page(pageNum, outPaths[pageNum], nb.Pages[pageNum].Hash)
+		opts.stats.addPages(0, 1)
+		logging.Info("wrote %s", outPaths[pageNum])
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d page(s) failed", failed, len(pages))
+	}
+	return nil
+}
+
+// frameDir is the folder a page's frames go into: its file name without extension
+func frameDir(file string) string {
+	return strings.TrimSuffix(file, filepath.Ext(file))
+}
+
+// frameDirs applies frameDir to every page file
+func frameDirs(files []string) []string {
+	dirs := make([]string, len(files))
+	for i, f := range files {
+		dirs[i] = frameDir(f)
+	}
+	return dirs
+}
+
+// saveReplayGIF writes a page's replay animation to outPath
+func saveReplayGIF(nb *note.Notebook, pageNum int, outPath string, ropts converter.ReplayOptions) error {
+	file, err := createOutput(outPath)
+	if err != nil {
+		return err
+	}
+	if err := converter.EncodeReplayGIF(file, nb, pageNum, ropts); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// frameFilePattern matches the files saveReplayFrames writes
+var frameFilePattern = regexp.MustCompile(`^frame_\d{4,}\.png$`)
+
+// saveReplayFrames writes frame_0000.png, frame_0001.png, ... into frameDir,
+// repeating the last frame to cover the final hold. Frames of an earlier,
+// longer replay are removed first so they do not trail the new one.
+func saveReplayFrames(nb *note.Notebook, pageNum int, frameDir string, ropts converter.ReplayOptions, enc *converter.PNGEncoder) error {
+	if err := os.MkdirAll(frameDir, 0755); err != nil {
+		return err
+	}
+	if err := removeFrames(frameDir); err != nil {
+		return err
+	}
+	frame := 0
+	err := converter.ReplayPage(nb, pageNum, ropts, func(canvas *note.GrayImage, _ image.Rectangle) error {
+		err := enc.Save(canvas, filepath.Join(frameDir, fmt.Sprintf("frame_%04d.png", frame)))
+		frame++
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	// The canvas is released once ReplayPage returns, so the hold repeats the
+	// finished frame's file instead of re-encoding it.
+	final := filepath.Join(frameDir, fmt.Sprintf("frame_%04d.png", frame-1))
+	for i := 0; i < ropts.HoldFrames(); i++ {
+		if err := copyFile(final, filepath.Join(frameDir, fmt.Sprintf("frame_%04d.png", frame))); err != nil {
+			return err
+		}
+		frame++
+	}
+	return nil
+}
+
+// removeFrames deletes the frame files in dir, leaving anything else alone
+func removeFrames(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.IsDir() && frameFilePattern.MatchString(e.Name()) {
+			if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// copyFile copies src to dst, replacing dst
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/merridan/sngo/internal/logging"
+)
+
+// runner converts the notes found under a set of paths. The default command
+// makes one run; watch mode makes one per batch of changed notes, reusing the
+// page pool and the state between them.
+type runner struct {
+	paths     []string
+	filter    *noteFilter
+	outDir    string
+	flat      bool
+	workers   int               // notes parsed at once
+	pageSpecs map[string]string // per-note pages from config.json
+	oneBased  bool
+	prune     bool
+	dryRun    bool // only list what pruning would remove; nothing is converted or saved
+	opts      *convertOptions
+	stop      <-chan struct{} // closed to start no more notes, e.g. on interrupt
+}
+
+// run converts the notes under r.paths. With only set it converts just those
+// notes (by absolute path); the others are still searched, since output
+// names and pruning depend on every note. It returns what the run did.
+func (r *runner) run(only map[string]bool) (*runStats, error) {
+	inputs, err := collectInputs(r.paths, r.filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("no .note files found in %s", strings.Join(r.paths, ", "))
+	}
+	if r.opts.stdout && len(inputs) != 1 {
+		return nil, fmt.Errorf("-stdout takes a single note, but %d were found", len(inputs))
+	}
+	if only == nil {
+		logging.Info("Found %d .note file(s)", len(inputs))
+	}
+	outputs, err := planOutputs(inputs, r.outDir, r.flat)
+	if err != nil {
+		return nil, err
+	}
+	if r.opts.notePages, err = notePageSpecs(r.pageSpecs, inputs, r.oneBased); err != nil {
+		return nil, fmt.Errorf("invalid pages in config.json: %v", err)
+	}
+	r.opts.stats = &runStats{}
+	if r.dryRun {
+		// Nothing is converted, moved or saved: the listing is against the
+		// outputs recorded by the last run.
+		n := pruneOutputs(inputs, r.opts.state, r.outDir, true)
+		logging.Info("-dry-run: would remove %d output(s)", n)
+		return r.opts.stats, nil
+	}
+	// Notes whose pages would overwrite another note's are not written at all
+	clashes := pageFileClashes(inputs, outputs, r.opts)
+	var safe []noteInput
+	for _, in := range inputs {
+		if clashes[in.path] == nil {
+			safe = append(safe, in)
+		}
+	}
+	if r.opts.state != nil {
+		trackRenames(safe, outputs, r.opts)
+	}
+
+	var noteFiles []string
+	for _, in := range inputs {
+		if only != nil {
+			if abs, err := filepath.Abs(in.path); err != nil || !only[abs] {
+				continue
+			}
+		}
+		if err := clashes[in.path]; err != nil {
+			logging.Error("failed to process %s: %v", in.path, err)
+			r.opts.stats.failed.Add(1)
+			continue
+		}
+		noteFiles = append(noteFiles, in.path)
+	}
+	stopped := convertNotes(noteFiles, outputs, r.workers, r.opts, r.stop)
+
+	if r.prune && stopped {
+		logging.Info("stopped before every note was converted; not pruning")
+	} else if r.prune {
+		logging.Info("pruned %d output(s)", pruneOutputs(inputs, r.opts.state, r.outDir, false))
+	}
+	if r.opts.state != nil {
+		saveState(r.opts.state)
+	}
+	logging.Info("%s", r.opts.stats.summary())
+	return r.opts.stats, nil
+}
+
+// convertNotes converts notes on a pool of file workers and waits for them.
+// Once stop is closed no further notes are started; the notes in progress are
+// finished, and it reports true.
+func convertNotes(noteFiles []string, outputs map[string]noteOutput, workers int, opts *convertOptions, stop <-chan struct{}) bool {
+	jobs := make(chan string, workers)
+	results := make(chan error, len(noteFiles))
+
+	// Worker function
+	worker := func(id int) {
+		for noteFile := range jobs {
+			logging.Info("Worker %d processing: %s", id, filepath.Base(noteFile))
+			err := processNoteFile(noteFile, outputs[noteFile], opts)
+			if err != nil {
+				logging.Error("failed to process %s: %v", noteFile, err)
+			}
+			results <- err
+		}
+	}
+
+	// Start workers
+	for w := 0; w < workers; w++ {
+		go worker(w)
+	}
+
+	// Send jobs
+	sent, stopped := 0, false
+send:
+	for _, noteFile := range noteFiles {
+		// Checked first, as select picks at random when a job slot is free too
+		select {
+		case <-stop:
+			stopped = true
+			break send
+		default:
+		}
+		select {
+		case jobs <- noteFile:
+			sent++
+		case <-stop:
+			stopped = true
+			break send
+		}
+	}
+	close(jobs)
+
+	// Wait for the results of the notes started
+	for i := 0; i < sent; i++ {
+		<-results
+	}
+	return stopped
+}
@@ -0,0 +1,24 @@
+package main
+
+// pagePool bounds how many pages are decoded and encoded at once across all
+// notebooks. File workers only parse and feed their pipeline; page work holds a
+// slot, so a single large notebook can use the whole -page-workers budget while
+// small notes queue behind it.
+type pagePool struct {
+	slots chan struct{}
+}
+
+func newPagePool(workers int) *pagePool {
+	if workers < 1 {
+		workers = 1
+	}
+	return &pagePool{slots: make(chan struct{}, workers)}
+}
+
+// Do waits for a free slot and runs fn while holding it. Callers must not
+// block on other pipeline stages inside fn, or the stages could starve each other.
+func (p *pagePool) Do(fn func()) {
+	p.slots <- struct{}{}
+	defer func() { <-p.slots }()
+	fn()
+}
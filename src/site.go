@@ -0,0 +1,206 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/merridan/sngo/internal/config"
+	"github.com/merridan/sngo/internal/converter"
+	"github.com/merridan/sngo/internal/logging"
+	"github.com/merridan/sngo/internal/note"
+	"github.com/merridan/sngo/internal/site"
+)
+
+// coverWidth is the width of index thumbnails in pixels
+const coverWidth = 320
+
+// runSite implements `supernote-tool site`: convert every note under the
+// input directory into the site's notes folder with the regular pipeline and
+// build a static HTML gallery around the pages.
+func runSite(args []string) {
+	fs := flag.NewFlagSet("site", flag.ExitOnError)
+	in := fs.String("in", "", "input directory containing .note files (uses supernote_path from config.json if blank)")
+	out := fs.String("out", "public", "output directory for the generated site")
+	logLevel := fs.String("log-level", "info", "logging level: debug, info, warn, error")
+	numWorkers := fs.Int("workers", 8, "number of parallel workers for processing notes")
+	var include, exclude stringList
+	fs.Var(&include, "include", "only include notes matching this glob (repeatable)")
+	fs.Var(&exclude, "exclude", "skip notes and folders matching this glob (repeatable)")
+	hidden := fs.Bool("hidden", false, "also search folders whose name starts with a dot")
+	force := fs.Bool("force", false, "convert every note, even if it is unchanged since the last build")
+	fs.Parse(args)
+	if *numWorkers < 1 {
+		log.Fatal("-workers must be at least 1")
+	}
+
+	logging.SetLevel(*logLevel)
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+	input := *in
+	if input == "" {
+		if cfg.SupernotePath == "" {
+			log.Fatal("supernote_path not configured in config.json and no input directory provided")
+		}
+		input = cfg.SupernotePath
+	}
+	names, err := parseNameTemplate("", cfg.NameTemplate, false)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r := newSiteRunner(input, *out, &noteFilter{include: include, exclude: exclude, hidden: *hidden}, names, *numWorkers)
+	r.pageSpecs = cfg.Pages
+	r.opts.force = *force
+	notebooks, err := buildSiteNotebooks(r, *out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := site.Build(*out, notebooks); err != nil {
+		log.Fatalf("failed to build site: %v", err)
+	}
+	logging.Info("wrote site with %d notebook(s) to %s", len(notebooks), *out)
+}
+
+// newSiteRunner converts the notes under input to PNG pages in outDir/notes,
+// keeping a state file there so unchanged notes are not converted again.
+func newSiteRunner(input, outDir string, filter *noteFilter, names *converter.NameTemplate, workers int) *runner {
+	notesDir := filepath.Join(outDir, "notes")
+	return &runner{
+		paths:   []string{input},
+		filter:  filter,
+		outDir:  notesDir,
+		workers: workers,
+		opts: &convertOptions{
+			pool:   newPagePool(workers),
+			png:    converter.NewPNGEncoder(converter.PNGOptions{Compression: png.DefaultCompression}),
+			format: formatPNG,
+			layout: layoutPages,
+			names:  names,
+			state:  loadState(notesDir),
+		},
+	}
+}
+
+// buildSiteNotebooks runs r and collects what the site shows about each note
+// from the pipeline: converted notes are described while they are still open,
+// unchanged ones are only parsed. Notes that fail are logged and left out.
+func buildSiteNotebooks(r *runner, outDir string) ([]*site.Notebook, error) {
+	var (
+		mu        sync.Mutex
+		notebooks []*site.Notebook
+	)
+	r.opts.noteDone = func(inputPath string, out noteOutput, nb *note.Notebook, pages []int, files []string) {
+		sn, err := describeSiteNotebook(inputPath, outDir, out, nb, pages, files, r.opts)
+		if err != nil {
+			logging.Error("failed to add %s to the site: %v", inputPath, err)
+			return
+		}
+		mu.Lock()
+		notebooks = append(notebooks, sn)
+		mu.Unlock()
+	}
+	if _, err := r.run(nil); err != nil {
+		return nil, err
+	}
+	sort.Slice(notebooks, func(i, j int) bool { return notebooks[i].Href() < notebooks[j].Href() })
+	return notebooks, nil
+}
+
+// describeSiteNotebook builds the site's view of a converted note. nb is nil
+// for notes skipped as unchanged, which are parsed to read their text.
+func describeSiteNotebook(inputPath, outDir string, out noteOutput, nb *note.Notebook, pages []int, files []string, opts *convertOptions) (*site.Notebook, error) {
+	if nb == nil {
+		var closer io.Closer
+		var err error
+		nb, pages, files, closer, err = readConvertedNote(inputPath, out, opts)
+		if err != nil {
+			return nil, err
+		}
+		// Text, titles and keywords are read from the file as they are needed
+		defer closer.Close()
+	}
+	dir, name := path.Split(filepath.ToSlash(out.rel))
+	sn := &site.Notebook{Name: name, Dir: strings.TrimSuffix(dir, "/")}
+	sn.Created = nb.FileID.CreatedAt()
+	sn.Keywords = converter.KeywordTexts(nb, sn.Name)
+	outline, pageText := converter.Outline(nb, sn.Name)
+	selected := map[int]bool{}
+	for _, pageNum := range pages {
+		selected[pageNum] = true
+		rel, err := filepath.Rel(outDir, files[pageNum])
+		if err != nil {
+			return nil, err
+		}
+		sn.Pages = append(sn.Pages, site.Page{Image: filepath.ToSlash(rel), Text: pageText[pageNum], Number: pageNum + 1})
+	}
+	for _, o := range outline {
+		if selected[o.Page] {
+			sn.Outline = append(sn.Outline, o)
+		}
+	}
+
+	if len(pages) > 0 {
+		sn.Cover = path.Join(sn.AssetDir(), "cover.png")
+		if err := saveCover(files[pages[0]], filepath.Join(outDir, filepath.FromSlash(sn.Cover)), opts.png); err != nil {
+			logging.Warn("%s: no cover: %v", inputPath, err)
+		}
+	}
+	return sn, nil
+}
+
+// readConvertedNote opens a note converted by an earlier run and returns the
+// pages and files that run wrote. The caller closes the note when done.
+func readConvertedNote(inputPath string, out noteOutput, opts *convertOptions) (*note.Notebook, []int, []string, io.Closer, error) {
+	nb, modTime, closer, err := openNote(inputPath)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	pages, err := opts.selectPages(inputPath, nb)
+	if err != nil {
+		closer.Close()
+		return nil, nil, nil, nil, err
+	}
+	files, err := pageFiles(nb, out, opts.pageExt(), modTime, opts.pageNames())
+	if err != nil {
+		closer.Close()
+		return nil, nil, nil, nil, err
+	}
+	return nb, pages, files, closer, nil
+}
+
+// saveCover writes a thumbnail of a written page file
+func saveCover(pageFile, outPath string, enc *converter.PNGEncoder) error {
+	f, err := os.Open(pageFile)
+	if err != nil {
+		return err
+	}
+	img, _, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("decode %s: %w", pageFile, err)
+	}
+	b := img.Bounds()
+	page := note.NewGrayImage(image.Rect(0, 0, b.Dx(), b.Dy()), false)
+	draw.Draw(page, page.Bounds(), img, b.Min, draw.Src)
+	thumb := converter.Thumbnail(page, coverWidth)
+	page.Release()
+	defer thumb.Release()
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return err
+	}
+	return enc.Save(thumb, outPath)
+}
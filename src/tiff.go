@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/merridan/sngo/internal/converter"
+	"github.com/merridan/sngo/internal/logging"
+	"github.com/merridan/sngo/internal/note"
+)
+
+// writeNotebookTIFF writes the selected pages of nb into one multi-page TIFF. Pages
+// are rendered and compressed in parallel on the page pool, then written in
+// order; only compressed strips are held in memory.
+func writeNotebookTIFF(nb *note.Notebook, pageNums []int, outPath string, modTime time.Time, opts *convertOptions) error {
+	scale := opts.scaleFor(nb)
+	dpi := int(math.Round(float64(nb.DeviceDPI()) * scale))
+
+	pages := make([]*converter.TIFFPage, len(pageNums))
+	pageErrs := make([]error, len(pageNums))
+	var wg sync.WaitGroup
+	for i, pageNum := range pageNums {
+		wg.Add(1)
+		go func(i, pageNum int) {
+			defer wg.Done()
+			opts.pool.Do(func() {
+				img, err := converter.ConvertPageToImageAt(nb, pageNum, scale)
+				if err != nil {
+					pageErrs[i] = err
+					return
+				}
+				pages[i], pageErrs[i] = converter.CompressTIFFPage(img, dpi)
+				releaseImage(img)
+			})
+		}(i, pageNum)
+	}
+	wg.Wait()
+	for i, err := range pageErrs {
+		if err != nil {
+			return fmt.Errorf("page %d: %w", pageNums[i], err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %v", filepath.Dir(outPath), err)
+	}
+	file, err := createOutput(outPath)
+	if err != nil {
+		return err
+	}
+	if err := converter.WriteTIFF(file, pages); err != nil {
+		file.Close()
+		return fmt.Errorf("write %s: %w", outPath, err)
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	setModTime(outPath, modTime)
+	logging.Info("wrote %s (%d pages, %d dpi)", outPath, len(pages), dpi)
+	return nil
+}
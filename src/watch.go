@@ -0,0 +1,256 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/merridan/sngo/internal/logging"
+)
+
+// defaultPollInterval is how often notes are scanned when file system
+// notifications are not available
+const defaultPollInterval = 5 * time.Second
+
+// maxParseAttempts is how many quiet periods a stable note that does not
+// parse is given before watch waits for it to change again
+const maxParseAttempts = 5
+
+// noteWatcher reports paths that may be notes that changed, appeared or
+// disappeared. Reports can be spurious; the watch loop checks each one.
+type noteWatcher interface {
+	Changes() <-chan string
+	Close() error
+}
+
+// pendingNote is a changed note waiting to settle
+type pendingNote struct {
+	changed  time.Time // last change reported
+	size     int64     // at the last change; -1 if the note was missing
+	modTime  time.Time
+	attempts int // times it was stable but did not parse
+}
+
+// watch runs once, then converts notes shortly after they change until the
+// process is interrupted. Sync clients write a note in bursts, and a
+// half-written note has a broken footer, so a note is only converted once
+// it has not changed for the debounce period and parses cleanly. Runs use the
+// shared page pool and state, and only convert the notes that changed.
+func (r *runner) watch(debounce, pollInterval time.Duration) {
+	for _, p := range r.paths {
+		if p == stdinPath {
+			log.Fatal("watch cannot read notes from standard input")
+		}
+	}
+	// An interrupt during a run lets the notes in progress finish, so no
+	// output is left half-written; a second one quits at once.
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	stop := make(chan struct{})
+	r.stop = stop
+	go func() {
+		<-interrupt
+		logging.Info("stopping watch once the notes being converted are done; interrupt again to quit now")
+		close(stop)
+		<-interrupt
+		os.Exit(1)
+	}()
+
+	// Start watching first, so changes made during the first run are not missed
+	w := r.newWatcher(pollInterval)
+	defer w.Close()
+	if _, err := r.run(nil); err != nil {
+		logging.Error("%v", err)
+	}
+
+	pending := map[string]*pendingNote{}
+	settle := time.NewTimer(debounce)
+	for {
+		select {
+		case <-stop:
+			logging.Info("stopping watch")
+			return
+		case path, ok := <-w.Changes():
+			if !ok {
+				logging.Error("watch stopped: change notifications ended")
+				return
+			}
+			if !isNoteFile(path) {
+				continue
+			}
+			if abs, err := filepath.Abs(path); err == nil {
+				path = abs
+			}
+			pending[path] = noteChanged(pending[path], path)
+			settle.Reset(debounce)
+		case <-settle.C:
+			ready, removed := settleNotes(pending, debounce, time.Now())
+			// Deleted notes only matter to -prune; renamed ones show up under their new name
+			if len(ready) > 0 || (removed && r.prune) {
+				if _, err := r.run(ready); err != nil {
+					logging.Error("%v", err)
+				}
+			}
+			if len(pending) > 0 {
+				settle.Reset(debounce)
+			}
+		}
+	}
+}
+
+// newWatcher watches the input paths with file system notifications, or by
+// polling if pollInterval is set or notifications are not available.
+func (r *runner) newWatcher(pollInterval time.Duration) noteWatcher {
+	if pollInterval == 0 {
+		w, err := newNotifyWatcher(r.paths, r.filter)
+		if err == nil {
+			logging.Info("watching %d path(s) for changes; press Ctrl-C to stop", len(r.paths))
+			return w
+		}
+		logging.Warn("file system notifications are not available (%v); polling instead", err)
+		pollInterval = defaultPollInterval
+	}
+	logging.Info("checking %d path(s) for changes every %v; press Ctrl-C to stop", len(r.paths), pollInterval)
+	return newPollWatcher(r.paths, r.filter, pollInterval)
+}
+
+// noteChanged records a change to a note
+func noteChanged(p *pendingNote, path string) *pendingNote {
+	if p == nil {
+		p = &pendingNote{}
+	}
+	p.changed = time.Now()
+	p.size, p.modTime = -1, time.Time{}
+	if info, err := os.Stat(path); err == nil {
+		p.size, p.modTime = info.Size(), info.ModTime()
+	}
+	return p
+}
+
+// settleNotes returns the pending notes that are ready to convert: unchanged
+// for the debounce period, with the size and time seen at their last change,
+// and parsing cleanly. Ready and removed notes leave pending; removed reports
+// whether any note was deleted or moved away.
+func settleNotes(pending map[string]*pendingNote, debounce time.Duration, now time.Time) (ready map[string]bool, removed bool) {
+	ready = map[string]bool{}
+	for path, p := range pending {
+		if now.Sub(p.changed) < debounce {
+			continue
+		}
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			delete(pending, path)
+			removed = true
+			continue
+		}
+		if err != nil {
+			logging.Warn("%s: %v", path, err)
+			delete(pending, path)
+			continue
+		}
+		// A write the watcher did not report still counts as a change
+		if info.Size() != p.size || !info.ModTime().Equal(p.modTime) {
+			p.changed, p.size, p.modTime = now, info.Size(), info.ModTime()
+			continue
+		}
+		nb, _, closer, err := openNote(path)
+		if err != nil {
+			p.attempts++
+			if p.attempts >= maxParseAttempts {
+				logging.Warn("%s does not parse, waiting for it to change again: %v", path, err)
+				delete(pending, path)
+				continue
+			}
+			logging.Debug("%s is not complete yet: %v", path, err)
+			p.changed = now
+			continue
+		}
+		closer.Close()
+		logging.Debug("%s settled with %d page(s)", path, len(nb.Pages))
+		ready[path] = true
+		delete(pending, path)
+	}
+	return ready, removed
+}
+
+// pollWatcher finds changes by scanning the input paths at an interval. It
+// works anywhere, including network shares that send no notifications.
+type pollWatcher struct {
+	paths    []string
+	filter   *noteFilter
+	interval time.Duration
+	changes  chan string
+	stop     chan struct{}
+}
+
+// fileStamp is what polling compares to tell that a file changed
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+func newPollWatcher(paths []string, filter *noteFilter, interval time.Duration) *pollWatcher {
+	w := &pollWatcher{paths: paths, filter: filter, interval: interval, changes: make(chan string), stop: make(chan struct{})}
+	go w.loop(w.scan())
+	return w
+}
+
+func (w *pollWatcher) Changes() <-chan string { return w.changes }
+
+func (w *pollWatcher) Close() error {
+	close(w.stop)
+	return nil
+}
+
+func (w *pollWatcher) loop(seen map[string]fileStamp) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+		next := w.scan()
+		var changed []string
+		for path, stamp := range next {
+			if old, ok := seen[path]; !ok || old.size != stamp.size || !old.modTime.Equal(stamp.modTime) {
+				changed = append(changed, path)
+			}
+		}
+		for path := range seen {
+			if _, ok := next[path]; !ok {
+				changed = append(changed, path)
+			}
+		}
+		seen = next
+		for _, path := range changed {
+			select {
+			case w.changes <- path:
+			case <-w.stop:
+				return
+			}
+		}
+	}
+}
+
+// scan stamps every note under the watched paths
+func (w *pollWatcher) scan() map[string]fileStamp {
+	stamps := map[string]fileStamp{}
+	for _, p := range w.paths {
+		files := []string{p}
+		if info, err := os.Stat(p); err == nil && info.IsDir() {
+			files, _ = findNoteFiles(p, w.filter)
+		}
+		for _, f := range files {
+			if info, err := os.Stat(f); err == nil {
+				stamps[f] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+			}
+		}
+	}
+	return stamps
+}
@@ -0,0 +1,213 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/merridan/sngo/internal/logging"
+)
+
+// notifyMask is what inotify reports: writes, and files and folders appearing or going
+const notifyMask = syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_CREATE | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// notifyWatcher watches every folder the note search visits with inotify.
+// Folders created or moved in later are added as they appear. The inotify
+// descriptor is non-blocking and read through the runtime's poller, so Close
+// wakes a pending read. Changed paths are collected in a set that a second
+// goroutine hands out, so a slow consumer never stalls reading events; a path
+// changed again before it is handed out is reported once.
+type notifyWatcher struct {
+	fd      int      // the inotify descriptor, for adding watches
+	file    *os.File // fd, read through the poller
+	filter  *noteFilter
+	changes chan string
+	wake    chan struct{} // signalled when pending gains a path
+	done    chan struct{} // closed when reading stops
+
+	mu      sync.Mutex
+	closed  bool
+	dirs    map[int32]string // watch descriptor -> folder
+	pending map[string]bool  // changed paths not handed out yet
+}
+
+func newNotifyWatcher(paths []string, filter *noteFilter) (noteWatcher, error) {
+	if filter == nil {
+		filter = &noteFilter{}
+	}
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify: %v", err)
+	}
+	w := &notifyWatcher{
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		filter:  filter,
+		changes: make(chan string),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		dirs:    map[int32]string{},
+		pending: map[string]bool{},
+	}
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			w.file.Close()
+			return nil, err
+		}
+		// A note named directly is watched through its folder
+		if !info.IsDir() {
+			err = w.add(filepath.Dir(p))
+		} else {
+			err = w.addTree(p)
+		}
+		if err != nil {
+			w.file.Close()
+			return nil, err
+		}
+	}
+	go w.read()
+	go w.deliver()
+	return w, nil
+}
+
+func (w *notifyWatcher) Changes() <-chan string { return w.changes }
+
+// Close stops the watcher; Changes is closed once both goroutines are done.
+func (w *notifyWatcher) Close() error {
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+	return w.file.Close()
+}
+
+// addTree watches dir and the folders under it that are searched for notes
+func (w *notifyWatcher) addTree(dir string) error {
+	dirs, err := findNoteDirs(dir, w.filter)
+	if err != nil {
+		return err
+	}
+	for _, d := range dirs {
+		if err := w.add(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *notifyWatcher) add(dir string) error {
+	// Holding mu keeps Close from releasing the descriptor while it is used
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, notifyMask)
+	if err != nil {
+		// ENOSPC means fs.inotify.max_user_watches is too low for the tree
+		return fmt.Errorf("inotify: watch %s: %v", dir, err)
+	}
+	w.dirs[int32(wd)] = dir
+	return nil
+}
+
+// read decodes inotify events until the watcher is closed or reading fails
+func (w *notifyWatcher) read() {
+	defer close(w.done)
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil || n <= 0 {
+			if !errors.Is(err, os.ErrClosed) {
+				logging.Debug("inotify: read stopped: %v", err)
+			}
+			return
+		}
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			start := off + syscall.SizeofInotifyEvent
+			name := strings.TrimRight(string(buf[start:start+int(ev.Len)]), "\x00")
+			off = start + int(ev.Len)
+			w.handle(ev.Wd, ev.Mask, name)
+		}
+	}
+}
+
+func (w *notifyWatcher) handle(wd int32, mask uint32, name string) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		logging.Warn("too many changes at once; some notes will be converted when they next change")
+		return
+	}
+	w.mu.Lock()
+	dir, ok := w.dirs[wd]
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(w.dirs, wd)
+	}
+	w.mu.Unlock()
+	if !ok || name == "" {
+		return
+	}
+	path := filepath.Join(dir, name)
+	if mask&syscall.IN_ISDIR == 0 {
+		w.changed(path)
+		return
+	}
+	if mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) == 0 || (strings.HasPrefix(name, ".") && !w.filter.hidden) {
+		return
+	}
+	if err := w.addTree(path); err != nil {
+		logging.Warn("not watching %s: %v", path, err)
+	}
+	// Notes moved in with a folder raise no events of their own
+	files, _ := findNoteFiles(path, w.filter)
+	for _, f := range files {
+		w.changed(f)
+	}
+}
+
+// changed adds path to the set waiting to be handed out, without blocking
+func (w *notifyWatcher) changed(path string) {
+	w.mu.Lock()
+	w.pending[path] = true
+	w.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver hands out pending paths on Changes until reading stops
+func (w *notifyWatcher) deliver() {
+	defer close(w.changes)
+	for {
+		select {
+		case <-w.wake:
+		case <-w.done:
+			return
+		}
+		w.mu.Lock()
+		paths := make([]string, 0, len(w.pending))
+		for p := range w.pending {
+			paths = append(paths, p)
+		}
+		w.pending = map[string]bool{}
+		w.mu.Unlock()
+		sort.Strings(paths)
+		for _, p := range paths {
+			select {
+			case w.changes <- p:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNotifyWatcher(t *testing.T) {
+	dir := t.TempDir()
+	w, err := newNotifyWatcher([]string{dir}, nil)
+	if err != nil {
+		t.Skipf("inotify not available: %v", err)
+	}
+	defer w.Close()
+
+	// A folder moved in with a note already inside raises no event for the note
+	staging := t.TempDir()
+	os.WriteFile(filepath.Join(staging, "a.note"), []byte("x"), 0644)
+	if err := os.Rename(staging, filepath.Join(dir, "Work")); err != nil {
+		t.Skipf("cannot move across temp folders: %v", err)
+	}
+	want := filepath.Join(dir, "Work", "a.note")
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case path := <-w.Changes():
+			if path == want {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("Expected a change to %s", want)
+		}
+	}
+}
+
+func TestNotifyWatcherClose(t *testing.T) {
+	dir := t.TempDir()
+	w, err := newNotifyWatcher([]string{dir}, nil)
+	if err != nil {
+		t.Skipf("inotify not available: %v", err)
+	}
+	// Far more changes than anyone reads must not stall the reader, and a
+	// hidden folder must not trip over the missing filter
+	if err := os.Mkdir(filepath.Join(dir, ".hidden"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 200; i++ {
+		os.WriteFile(filepath.Join(dir, fmt.Sprintf("%03d.note", i)), []byte("x"), 0644)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// Close wakes the blocked read, after which Changes ends
+	w.Close()
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-w.Changes():
+			if !ok {
+				return
+			}
+		case <-deadline:
+			t.Fatal("Expected Changes to be closed after Close")
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// newNotifyWatcher is only implemented with inotify; elsewhere watch polls.
+func newNotifyWatcher(paths []string, filter *noteFilter) (noteWatcher, error) {
+	return nil, fmt.Errorf("not supported on %s", runtime.GOOS)
+}
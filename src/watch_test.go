@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/merridan/sngo/internal/converter"
+)
+
+func TestSettleNotes(t *testing.T) {
+	dir := t.TempDir()
+	data, err := os.ReadFile("../example_notes/example.note")
+	if err != nil {
+		t.Fatal(err)
+	}
+	complete := filepath.Join(dir, "complete.note")
+	partial := filepath.Join(dir, "partial.note")
+	recent := filepath.Join(dir, "recent.note")
+	gone := filepath.Join(dir, "gone.note")
+	os.WriteFile(complete, data, 0644)
+	os.WriteFile(partial, data[:len(data)/2], 0644) // half-synced: no footer
+	os.WriteFile(recent, data, 0644)
+
+	pending := map[string]*pendingNote{}
+	for _, p := range []string{complete, partial, recent, gone} {
+		pending[p] = noteChanged(nil, p)
+	}
+	debounce := time.Second
+	now := time.Now().Add(debounce)
+	pending[recent].changed = now
+
+	ready, removed := settleNotes(pending, debounce, now)
+	if !ready[complete] || len(ready) != 1 {
+		t.Errorf("Expected only the complete note to be ready, got %v", ready)
+	}
+	if !removed {
+		t.Error("Expected the missing note to be reported as removed")
+	}
+	if p := pending[partial]; p == nil || p.attempts != 1 {
+		t.Errorf("Expected the partial note to wait for another try, got %+v", p)
+	}
+	if pending[recent] == nil {
+		t.Error("Expected the recently changed note to wait for the debounce period")
+	}
+	if pending[complete] != nil || pending[gone] != nil {
+		t.Error("Expected ready and removed notes to leave pending")
+	}
+
+	// A partial note that stays broken is given up on until it changes again
+	for i := 1; i < maxParseAttempts; i++ {
+		now = now.Add(debounce)
+		settleNotes(pending, debounce, now)
+	}
+	if pending[partial] != nil {
+		t.Error("Expected a note that never parses to leave pending")
+	}
+}
+
+func TestPollWatcher(t *testing.T) {
+	dir := t.TempDir()
+	w := newPollWatcher([]string{dir}, nil, 10*time.Millisecond)
+	defer w.Close()
+	note := filepath.Join(dir, "Work", "a.note")
+	os.MkdirAll(filepath.Dir(note), 0755)
+	if err := os.WriteFile(note, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case path := <-w.Changes():
+		if path != note {
+			t.Errorf("Expected a change to %s, got %s", note, path)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the new note to be reported")
+	}
+}
+
+func TestRunStopped(t *testing.T) {
+	outDir := t.TempDir()
+	stop := make(chan struct{})
+	close(stop)
+	r := &runner{
+		paths:   []string{"../example_notes/example.note"},
+		outDir:  outDir,
+		workers: 1,
+		prune:   true,
+		opts:    &convertOptions{pool: newPagePool(1), png: converter.NewPNGEncoder(converter.PNGOptions{}), format: formatPNG, layout: layoutPages},
+		stop:    stop,
+	}
+	stats, err := r.run(nil)
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if n := stats.converted.Load(); n != 0 {
+		t.Errorf("Expected a stopped run to start no notes, %d were converted", n)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "example")); !os.IsNotExist(err) {
+		t.Errorf("Expected no outputs after a stopped run: %v", err)
+	}
+}